@@ -0,0 +1,82 @@
+package opac
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// WithBuiltin registers a custom built-in function implemented in Go for local sources (Files, Data, FS and Bundle). The declaration has the name, the types of arguments and the result, and flags of the function, and it is used for both compiling policies and evaluating queries. Set Memoize for a deterministic function to cache its result for the same arguments within a query, and set Nondeterministic for a function whose result can change for the same arguments, such as a lookup of a table updated in process. Remote source ignores the option because built-in functions must be registered in OPA server.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Files("policy"), opac.WithBuiltin(
+//		&rego.Function{
+//			Name: "internal.parse_id",
+//			Decl: types.NewFunction(types.Args(types.S), types.S),
+//		},
+//		func(_ rego.BuiltinContext, args []*ast.Term) (*ast.Term, error) {
+//			id, ok := args[0].Value.(ast.String)
+//			if !ok {
+//				return nil, nil // undefined
+//			}
+//			return ast.StringTerm(strings.SplitN(string(id), ":", 2)[0]), nil
+//		},
+//	))
+func WithBuiltin(decl *rego.Function, impl rego.BuiltinDyn) Option {
+	return func(cfg *config) {
+		cfg.builtins = append(cfg.builtins, &builtin{
+			decl: decl,
+			impl: impl,
+		})
+	}
+}
+
+type builtin struct {
+	decl *rego.Function
+	impl rego.BuiltinDyn
+}
+
+// validateBuiltins checks declarations of custom built-in functions. A name of an OPA built-in function can not be used.
+func validateBuiltins(builtins []*builtin) error {
+	names := make(map[string]struct{}, len(builtins))
+	for _, b := range builtins {
+		if b.decl == nil || b.decl.Name == "" || b.decl.Decl == nil {
+			return fmt.Errorf("invalid built-in function: name and declaration are required")
+		}
+		if b.impl == nil {
+			return fmt.Errorf("invalid built-in function %s: implementation is required", b.decl.Name)
+		}
+		if _, ok := ast.BuiltinMap[b.decl.Name]; ok {
+			return fmt.Errorf("invalid built-in function %s: it is already defined by OPA", b.decl.Name)
+		}
+		if _, ok := names[b.decl.Name]; ok {
+			return fmt.Errorf("invalid built-in function %s: it is registered more than once", b.decl.Name)
+		}
+		names[b.decl.Name] = struct{}{}
+	}
+	return nil
+}
+
+// builtinDecls returns declarations of the custom built-in functions for the compiler.
+func builtinDecls(builtins []*builtin) map[string]*ast.Builtin {
+	decls := make(map[string]*ast.Builtin, len(builtins))
+	for _, b := range builtins {
+		decls[b.decl.Name] = &ast.Builtin{
+			Name:             b.decl.Name,
+			Decl:             b.decl.Decl,
+			Nondeterministic: b.decl.Nondeterministic,
+		}
+	}
+	return decls
+}
+
+// builtinOptions returns options of rego to evaluate the custom built-in functions.
+func builtinOptions(builtins []*builtin) []func(*rego.Rego) {
+	options := make([]func(*rego.Rego), 0, len(builtins))
+	for _, b := range builtins {
+		options = append(options, rego.FunctionDyn(b.decl, b.impl))
+	}
+	return options
+}
@@ -0,0 +1,139 @@
+package opac_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/types"
+)
+
+const builtinPolicy = `package authz
+
+allow if internal.parse_id(input.id) == "tenant1"
+`
+
+var parseID = opac.WithBuiltin(
+	&rego.Function{
+		Name: "internal.parse_id",
+		Decl: types.NewFunction(types.Args(types.S), types.S),
+	},
+	func(_ rego.BuiltinContext, args []*ast.Term) (*ast.Term, error) {
+		id, ok := args[0].Value.(ast.String)
+		if !ok {
+			return nil, nil
+		}
+		return ast.StringTerm(strings.SplitN(string(id), ":", 2)[0]), nil
+	},
+)
+
+func TestBuiltin(t *testing.T) {
+	ctx := context.Background()
+
+	sources := map[string]opac.Source{
+		"data": opac.Data(map[string]string{"policy.rego": builtinPolicy}),
+		"fs":   opac.FS(fstest.MapFS{"policy/authz.rego": {Data: []byte(builtinPolicy)}}, "policy"),
+	}
+	for name, src := range sources {
+		t.Run(name, func(t *testing.T) {
+			client := gt.R1(opac.New(src, parseID)).NoError(t)
+
+			allowed := gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", map[string]any{"id": "tenant1:user1"})).NoError(t)
+			gt.True(t, allowed)
+
+			_, err := opac.QueryAs[bool](ctx, client, "data.authz.allow", map[string]any{"id": "tenant2:user1"})
+			gt.True(t, errors.Is(err, opac.ErrNoEvalResult))
+		})
+	}
+
+	t.Run("used in query", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": builtinPolicy}), parseID)).NoError(t)
+		tenant := gt.R1(opac.QueryAs[string](ctx, client, `internal.parse_id("tenant3:user1")`, nil)).NoError(t)
+		gt.Equal(t, tenant, "tenant3")
+	})
+
+	t.Run("not registered", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": builtinPolicy}))
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		policy := "package authz\n\nallow if internal.parse_id(1) == \"tenant1\"\n"
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": policy}), parseID)
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+		gt.Equal(t, compileErr.Errors[0].Code, "rego_type_error")
+	})
+
+	t.Run("name of OPA built-in", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": builtinPolicy}), parseID, opac.WithBuiltin(
+			&rego.Function{Name: "count", Decl: types.NewFunction(types.Args(types.A), types.N)},
+			func(_ rego.BuiltinContext, _ []*ast.Term) (*ast.Term, error) { return nil, nil },
+		))
+		gt.Error(t, err)
+	})
+
+	t.Run("no implementation", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": builtinPolicy}), opac.WithBuiltin(
+			&rego.Function{Name: "internal.parse_id", Decl: types.NewFunction(types.Args(types.S), types.S)}, nil,
+		))
+		gt.Error(t, err)
+	})
+}
+
+func TestBuiltinMemoize(t *testing.T) {
+	policy := `package authz
+
+allow if {
+	internal.reputation(input.ip) > 50
+	internal.reputation(input.ip) < 90
+}
+`
+	reputation := func(memoize bool, called *int) opac.Option {
+		return opac.WithBuiltin(
+			&rego.Function{
+				Name:    "internal.reputation",
+				Decl:    types.NewFunction(types.Args(types.S), types.N),
+				Memoize: memoize,
+			},
+			func(_ rego.BuiltinContext, _ []*ast.Term) (*ast.Term, error) {
+				*called++
+				return ast.IntNumberTerm(80), nil
+			},
+		)
+	}
+	input := map[string]any{"ip": "192.0.2.1"}
+
+	for _, memoize := range []bool{true, false} {
+		var called int
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}), reputation(memoize, &called))).NoError(t)
+		allowed := gt.R1(opac.QueryAs[bool](context.Background(), client, "data.authz.allow", input)).NoError(t)
+		gt.True(t, allowed)
+		if memoize {
+			gt.Equal(t, called, 1)
+		} else {
+			gt.Equal(t, called, 2)
+		}
+	}
+}
+
+func TestBuiltinPartial(t *testing.T) {
+	policy := `package authz
+
+allow if {
+	internal.parse_id(input.resource.id) == input.subject.tenant
+}
+`
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}), parseID)).NoError(t)
+	input := map[string]any{"subject": map[string]any{"tenant": "tenant1"}}
+	result := gt.R1(client.Partial(context.Background(), "data.authz.allow == true", input, []string{"input.resource"})).NoError(t)
+	gt.A(t, result.Queries).Length(1)
+	gt.True(t, strings.Contains(result.Queries[0].String(), "internal.parse_id(input.resource.id"))
+}
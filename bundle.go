@@ -0,0 +1,271 @@
+package opac
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/bundle"
+)
+
+type bundleSource struct {
+	localEngine
+	path         string
+	reader       io.Reader
+	verification *bundle.VerificationConfig
+	scope        string
+	watcher      *watcher
+
+	// fields for BundleServer
+	url             string
+	httpClient      HTTPClient
+	pollingInterval time.Duration
+	timeout         time.Duration
+	etag            string
+	digest          [sha256.Size]byte
+}
+
+// BundleOption is a function that configures the Bundle source.
+type BundleOption func(*bundleSource)
+
+// WithVerificationKey adds a key to verify the signature of the bundle in .signatures.json, the format used by OPA. The algorithm is one of RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512, HS256, HS384 and HS512. The key is a PEM encoded public key for RSA and ECDSA, or a shared secret for HMAC. The keyID must match "kid" of the signature.
+//
+// If one or more keys are set, opac.New returns *BundleVerificationError when the signature is missing, invalid or does not cover every file in the bundle.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Bundle("bundle.tar.gz",
+//		opac.WithVerificationKey("ci", "RS256", publicKeyPEM),
+//	))
+func WithVerificationKey(keyID, algorithm, key string) BundleOption {
+	return func(b *bundleSource) {
+		if b.verification == nil {
+			b.verification = bundle.NewVerificationConfig(map[string]*bundle.KeyConfig{}, "", "", nil)
+		}
+		b.verification.PublicKeys[keyID] = &bundle.KeyConfig{
+			Key:       key,
+			Algorithm: algorithm,
+		}
+	}
+}
+
+// WithVerificationScope sets the scope that must match the scope in the bundle signature. It is ignored unless a key is set by WithVerificationKey.
+func WithVerificationScope(scope string) BundleOption {
+	return func(b *bundleSource) {
+		b.scope = scope
+	}
+}
+
+// Bundle is an option to read policies and base documents from an OPA bundle. The path can be a bundle tarball (.tar.gz) or a bundle directory. Roots in the .manifest file are enforced and the revision is available with Client.Revision.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Bundle("path/to/bundle.tar.gz"))
+func Bundle(path string, options ...BundleOption) Source {
+	src := &bundleSource{
+		path: path,
+	}
+	for _, opt := range options {
+		opt(src)
+	}
+	return src
+}
+
+// BundleReader is an option to read an OPA bundle tarball (.tar.gz) from the reader. The reader is consumed in opac.New.
+func BundleReader(r io.Reader, options ...BundleOption) Source {
+	src := &bundleSource{
+		reader: r,
+	}
+	for _, opt := range options {
+		opt(src)
+	}
+	return src
+}
+
+// Configure implements Source.
+func (b *bundleSource) Configure(cfg *config) error {
+	if b.url != "" {
+		return b.configureServer(cfg)
+	}
+
+	if err := b.configurePolicies(cfg, func() (*policySet, error) { return b.load(cfg) }); err != nil {
+		return err
+	}
+
+	if cfg.watchInterval > 0 && b.reader == nil {
+		b.watcher = startWatcher(cfg, cfg.watchInterval,
+			func() (fileStamps, error) {
+				return statFiles([]string{b.path}, func(string) bool { return true })
+			},
+			func() {
+				b.reload(func() (*policySet, error) { return b.load(cfg) })
+			},
+		)
+	}
+
+	return nil
+}
+
+// Close stops watching or polling the bundle.
+func (b *bundleSource) Close() error {
+	b.watcher.stop()
+	return nil
+}
+
+func (b *bundleSource) load(cfg *config) (*policySet, error) {
+	newLoader, err := b.loader(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.loadWith(cfg, newLoader)
+}
+
+// loadWith reads the bundle with loaders created by newLoader and compiles it.
+func (b *bundleSource) loadWith(cfg *config, newLoader func() bundle.DirectoryLoader) (*policySet, error) {
+	loaded, err := b.read(cfg, newLoader)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := newBundlePolicySet(cfg, loaded)
+	if err != nil {
+		return nil, err
+	}
+	cfg.logger.Debug("Bundle is loaded", "revision", policies.revision, "module count", len(loaded.Modules))
+
+	return policies, nil
+}
+
+// read loads the bundle. If verification keys are set, the bundle is read twice: the first read checks the bundle format, and the second read verifies the signature. Then any error of the second read can be reported as a verification failure.
+func (b *bundleSource) read(cfg *config, newLoader func() bundle.DirectoryLoader) (*bundle.Bundle, error) {
+	loaded, err := readBundle(cfg, newLoader(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.verification == nil {
+		return loaded, nil
+	}
+
+	signed, err := hasSignatures(newLoader())
+	if err != nil {
+		return nil, err
+	}
+	if !signed {
+		return nil, &BundleVerificationError{Err: ErrMissingBundleSignature}
+	}
+
+	cfg.logger.Debug("Verifying bundle signature")
+	b.verification.Scope = b.scope
+	verified, err := readBundle(cfg, newLoader(), b.verification)
+	if err != nil {
+		return nil, &BundleVerificationError{Err: err}
+	}
+
+	return verified, nil
+}
+
+// loader returns a function to create a new loader of the bundle. The bundle tarball is read into memory so that it can be loaded more than once.
+func (b *bundleSource) loader(cfg *config) (func() bundle.DirectoryLoader, error) {
+	if b.reader != nil {
+		cfg.logger.Debug("Reading bundle from reader")
+		raw, err := io.ReadAll(b.reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		return func() bundle.DirectoryLoader {
+			return bundle.NewTarballLoader(bytes.NewReader(raw))
+		}, nil
+	}
+
+	cfg.logger.Debug("Reading bundle", "path", b.path)
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	if info.IsDir() {
+		return func() bundle.DirectoryLoader {
+			return bundle.NewDirectoryLoader(b.path)
+		}, nil
+	}
+
+	raw, err := os.ReadFile(b.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	return func() bundle.DirectoryLoader {
+		return bundle.NewTarballLoaderWithBaseURL(bytes.NewReader(raw), b.path)
+	}, nil
+}
+
+// readBundle reads the bundle with the loader. The signature is verified only if verification is not nil. Modules are parsed with the default Rego version of the client unless the manifest specifies it.
+func readBundle(cfg *config, loader bundle.DirectoryLoader, verification *bundle.VerificationConfig) (*bundle.Bundle, error) {
+	reader := bundle.NewCustomReader(loader).
+		WithProcessAnnotations(true).
+		WithRegoVersion(cfg.regoVersion)
+	if verification != nil {
+		reader = reader.WithBundleVerificationConfig(verification)
+	} else {
+		reader = reader.WithSkipBundleVerification(true)
+	}
+
+	loaded, err := reader.Read()
+	if err != nil {
+		var astErrs ast.Errors
+		if errors.As(err, &astErrs) {
+			return nil, newCompileError("failed to read bundle", err)
+		}
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	return &loaded, nil
+}
+
+// hasSignatures returns true if the bundle has .signatures.json file.
+func hasSignatures(loader bundle.DirectoryLoader) (bool, error) {
+	for {
+		f, err := loader.NextFile()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if strings.HasSuffix(f.Path(), bundle.SignaturesFile) {
+			return true, nil
+		}
+	}
+}
+
+// newBundlePolicySet compiles modules of the bundle and creates the policy set with base documents of the bundle.
+func newBundlePolicySet(cfg *config, b *bundle.Bundle) (*policySet, error) {
+	if len(b.Modules) == 0 {
+		return nil, ErrNoPolicyData
+	}
+
+	modules := make(map[string]*ast.Module, len(b.Modules))
+	for _, mf := range b.Modules {
+		modules[mf.Path] = mf.Parsed
+	}
+
+	compiler, warnings, err := compileModules(cfg, modules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &policySet{
+		compiler: compiler,
+		store:    newStore(b.Data),
+		revision: b.Manifest.Revision,
+		warnings: warnings,
+	}, nil
+}
+
+var _ Source = (*bundleSource)(nil)
@@ -0,0 +1,177 @@
+package opac
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/bundle"
+)
+
+const (
+	// defaultBundlePollingInterval is the default interval to re-fetch a bundle from a bundle server.
+	defaultBundlePollingInterval = time.Minute
+
+	// defaultBundleTimeout is the default timeout to download a bundle from a bundle server.
+	defaultBundleTimeout = 30 * time.Second
+)
+
+// BundleServer is an option to download an OPA bundle tarball from the URL of a bundle server. The bundle is downloaded in opac.New and re-fetched in background at the polling interval with ETag and If-None-Match header. A downloaded bundle identical to the current one is not reloaded even if the server does not send ETag. If downloading, verifying or compiling a new bundle fails, the last good bundle is kept. The result of reloading is reported through the logger and the callback set by WithReloadCallback. Client.Close should be called to stop polling.
+//
+// Example:
+//
+//	client, err := opac.New(opac.BundleServer("https://bundle.example.com/bundles/authz.tar.gz",
+//		opac.WithPollingInterval(30*time.Second),
+//	))
+func BundleServer(url string, options ...BundleOption) Source {
+	src := &bundleSource{
+		url:             url,
+		httpClient:      http.DefaultClient,
+		pollingInterval: defaultBundlePollingInterval,
+		timeout:         defaultBundleTimeout,
+	}
+	for _, opt := range options {
+		opt(src)
+	}
+	return src
+}
+
+// WithBundleHTTPClient sets the HTTP client to download a bundle for BundleServer. The default is http.DefaultClient.
+func WithBundleHTTPClient(client HTTPClient) BundleOption {
+	return func(b *bundleSource) {
+		b.httpClient = client
+	}
+}
+
+// WithPollingInterval sets the interval to re-fetch a bundle for BundleServer. Zero or a negative value disables polling. The default is 1 minute.
+func WithPollingInterval(interval time.Duration) BundleOption {
+	return func(b *bundleSource) {
+		b.pollingInterval = interval
+	}
+}
+
+// WithBundleTimeout sets the timeout to download a bundle for BundleServer, including the initial download in opac.New. Zero or a negative value disables the timeout. The default is 30 seconds.
+func WithBundleTimeout(timeout time.Duration) BundleOption {
+	return func(b *bundleSource) {
+		b.timeout = timeout
+	}
+}
+
+func (b *bundleSource) configureServer(cfg *config) error {
+	err := b.configurePolicies(cfg, func() (*policySet, error) {
+		raw, err := b.download(context.Background(), cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		policies, err := b.loadWith(cfg, b.serverLoader(raw.body))
+		if err != nil {
+			return nil, err
+		}
+		b.etag = raw.etag
+		b.digest = sha256.Sum256(raw.body)
+		return policies, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if b.pollingInterval > 0 {
+		b.watcher = startPolling(b.pollingInterval, func(ctx context.Context) {
+			b.poll(ctx, cfg)
+		})
+	}
+
+	return nil
+}
+
+func (b *bundleSource) poll(ctx context.Context, cfg *config) {
+	raw, err := b.download(ctx, cfg)
+	if err == nil && raw == nil {
+		cfg.logger.Debug("Bundle is not modified", "url", b.url, "etag", b.etag)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err == nil && sha256.Sum256(raw.body) == b.digest {
+		cfg.logger.Debug("Bundle is not changed", "url", b.url, "etag", raw.etag)
+		b.etag = raw.etag
+		return
+	}
+
+	b.reload(func() (*policySet, error) {
+		if err != nil {
+			return nil, err
+		}
+
+		policies, err := b.loadWith(cfg, b.serverLoader(raw.body))
+		if err != nil {
+			return nil, err
+		}
+
+		// ETag and digest are updated only for a good bundle, so that a bad bundle is downloaded and reported again.
+		b.etag = raw.etag
+		b.digest = sha256.Sum256(raw.body)
+		return policies, nil
+	})
+}
+
+func (b *bundleSource) serverLoader(raw []byte) func() bundle.DirectoryLoader {
+	return func() bundle.DirectoryLoader {
+		return bundle.NewTarballLoaderWithBaseURL(bytes.NewReader(raw), b.url)
+	}
+}
+
+type bundleDownload struct {
+	body []byte
+	etag string
+}
+
+// download fetches the bundle from the bundle server within the timeout. It returns nil without error if the bundle is not modified.
+func (b *bundleSource) download(ctx context.Context, cfg *config) (*bundleDownload, error) {
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request to bundle server: %w", err)
+	}
+	if b.etag != "" {
+		req.Header.Set("If-None-Match", b.etag)
+	}
+
+	cfg.logger.Debug("Downloading bundle", "url", b.url, "etag", b.etag)
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to bundle server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	cfg.logger.Debug("Received response from bundle server", "status", resp.StatusCode, "size", len(body))
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle from bundle server: %w", err)
+		}
+		return &bundleDownload{
+			body: body,
+			etag: resp.Header.Get("ETag"),
+		}, nil
+
+	case http.StatusNotModified:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected status code from bundle server: %d msg='%s'", resp.StatusCode, string(body))
+	}
+}
@@ -0,0 +1,253 @@
+package opac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+// bundleServer serves a bundle tarball with ETag for testing.
+type bundleServer struct {
+	mutex    sync.Mutex
+	body     []byte
+	etag     string
+	status   int
+	requests []*http.Request
+}
+
+func (x *bundleServer) set(body []byte, etag string, status int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.body, x.etag, x.status = body, etag, status
+}
+
+func (x *bundleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.requests = append(x.requests, r)
+
+	if x.status != http.StatusOK {
+		w.WriteHeader(x.status)
+		return
+	}
+	if x.etag != "" && r.Header.Get("If-None-Match") == x.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if x.etag != "" {
+		w.Header().Set("ETag", x.etag)
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	_, _ = w.Write(x.body)
+}
+
+func TestBundleServer(t *testing.T) {
+	bs := &bundleServer{}
+	bs.set(writeBundle(t, newTestBundle("v1")), `"v1"`, http.StatusOK)
+	server := httptest.NewServer(bs)
+	defer server.Close()
+
+	// failures are reported at every poll, then the callback must not block
+	events := make(chan opac.ReloadEvent, 256)
+	client := gt.R1(opac.New(
+		opac.BundleServer(server.URL+"/bundles/authz.tar.gz",
+			opac.WithPollingInterval(10*time.Millisecond),
+		),
+		opac.WithReloadCallback(func(event opac.ReloadEvent) {
+			select {
+			case events <- event:
+			default:
+			}
+		}),
+	)).NoError(t)
+	defer client.Close()
+	gt.Equal(t, client.Revision(), "v1")
+
+	// wait for a few polls with If-None-Match
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected reload for not modified bundle: %+v", event)
+	default:
+	}
+	bs.mutex.Lock()
+	gt.A(t, bs.requests).Longer(1)
+	gt.Equal(t, bs.requests[1].Header.Get("If-None-Match"), `"v1"`)
+	gt.Equal(t, bs.requests[0].URL.Path, "/bundles/authz.tar.gz")
+	bs.mutex.Unlock()
+
+	t.Run("new bundle", func(t *testing.T) {
+		bs.set(writeBundle(t, newTestBundle("v2")), `"v2"`, http.StatusOK)
+		event := waitReload(t, events)
+		gt.NoError(t, event.Err)
+		gt.Equal(t, event.Revision, "v2")
+		gt.Equal(t, client.Revision(), "v2")
+	})
+
+	t.Run("server error keeps the last good bundle", func(t *testing.T) {
+		bs.set(nil, "", http.StatusInternalServerError)
+		event := waitReload(t, events)
+		gt.Error(t, event.Err)
+		gt.Equal(t, event.Revision, "v2")
+
+		var output struct {
+			Allow bool `json:"allow"`
+		}
+		gt.NoError(t, client.Query(context.Background(), "data.authz", map[string]any{"user": "alice"}, &output))
+		gt.True(t, output.Allow)
+	})
+
+	t.Run("broken bundle keeps the last good bundle", func(t *testing.T) {
+		bs.set([]byte("broken"), `"broken"`, http.StatusOK)
+		event := waitReload(t, events)
+		gt.Error(t, event.Err)
+		gt.Equal(t, client.Revision(), "v2")
+	})
+
+	t.Run("recover", func(t *testing.T) {
+		bs.set(writeBundle(t, newTestBundle("v3")), `"v3"`, http.StatusOK)
+		for {
+			event := waitReload(t, events)
+			if event.Err == nil {
+				gt.Equal(t, event.Revision, "v3")
+				break
+			}
+		}
+		gt.Equal(t, client.Revision(), "v3")
+	})
+}
+
+func TestBundleServerWithoutETag(t *testing.T) {
+	bs := &bundleServer{}
+	bs.set(writeBundle(t, newTestBundle("v1")), "", http.StatusOK)
+	server := httptest.NewServer(bs)
+	defer server.Close()
+
+	events := make(chan opac.ReloadEvent, 256)
+	client := gt.R1(opac.New(
+		opac.BundleServer(server.URL+"/bundles/authz.tar.gz",
+			opac.WithPollingInterval(10*time.Millisecond),
+		),
+		opac.WithReloadCallback(func(event opac.ReloadEvent) {
+			select {
+			case events <- event:
+			default:
+			}
+		}),
+	)).NoError(t)
+	defer client.Close()
+
+	// The same bundle is downloaded at every poll, but not reloaded
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected reload for unchanged bundle: %+v", event)
+	default:
+	}
+	bs.mutex.Lock()
+	gt.A(t, bs.requests).Longer(1)
+	bs.mutex.Unlock()
+
+	bs.set(writeBundle(t, newTestBundle("v2")), "", http.StatusOK)
+	event := waitReload(t, events)
+	gt.NoError(t, event.Err)
+	gt.Equal(t, event.Revision, "v2")
+}
+
+func TestBundleServerTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	start := time.Now()
+	_, err := opac.New(opac.BundleServer(server.URL+"/bundles/authz.tar.gz",
+		opac.WithBundleTimeout(50*time.Millisecond),
+	))
+	gt.Error(t, err)
+	gt.True(t, errors.Is(err, context.DeadlineExceeded))
+	gt.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestBundleServerWithHTTPClient(t *testing.T) {
+	body := writeBundle(t, newTestBundle("v1"))
+
+	type testCase struct {
+		do     func(req *http.Request) (*http.Response, error)
+		newErr bool
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			client, err := opac.New(opac.BundleServer("https://example.com/bundle.tar.gz",
+				opac.WithBundleHTTPClient(&httpMock{do: tc.do}),
+				opac.WithPollingInterval(0),
+			))
+			if tc.newErr {
+				gt.Error(t, err)
+				return
+			}
+			gt.NoError(t, err)
+			defer client.Close()
+			gt.Equal(t, client.Revision(), "v1")
+		}
+	}
+
+	t.Run("success", doTest(testCase{
+		do: func(req *http.Request) (*http.Response, error) {
+			gt.Equal(t, req.Method, http.MethodGet)
+			gt.Equal(t, req.URL.String(), "https://example.com/bundle.tar.gz")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Etag": []string{`"v1"`}},
+				Body:       io.NopCloser(strings.NewReader(string(body))),
+			}, nil
+		},
+	}))
+
+	t.Run("client error", doTest(testCase{
+		do: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("some error")
+		},
+		newErr: true,
+	}))
+
+	t.Run("not found", doTest(testCase{
+		do: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       io.NopCloser(strings.NewReader("not found")),
+			}, nil
+		},
+		newErr: true,
+	}))
+}
+
+func TestBundleServerVerification(t *testing.T) {
+	bs := &bundleServer{}
+	bs.set(writeBundle(t, newTestBundle("v1")), `"v1"`, http.StatusOK)
+	server := httptest.NewServer(bs)
+	defer server.Close()
+
+	_, err := opac.New(opac.BundleServer(fmt.Sprintf("%s/bundle.tar.gz", server.URL),
+		opac.WithVerificationKey("ci", "HS256", "secret"),
+	))
+	var verifyErr *opac.BundleVerificationError
+	gt.True(t, errors.As(err, &verifyErr))
+}
@@ -0,0 +1,267 @@
+package opac_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/open-policy-agent/opa/v1/bundle"
+	"github.com/open-policy-agent/opa/v1/util"
+)
+
+func newTestBundle(revision string) map[string]string {
+	return map[string]string{
+		".manifest":         `{"revision": "` + revision + `", "roots": ["authz", "roles"]}`,
+		"authz/policy.rego": "package authz\n\nallow if {\n    data.roles[input.user] == \"admin\"\n}\n",
+		"roles/data.json":   `{"alice": "admin", "bob": "viewer"}`,
+	}
+}
+
+func writeBundle(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		gt.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     "/" + name,
+			Mode:     0600,
+			Typeflag: tar.TypeReg,
+			Size:     int64(len(content)),
+		}))
+		gt.R1(tw.Write([]byte(content))).NoError(t)
+	}
+	gt.NoError(t, tw.Close())
+	gt.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestBundle(t *testing.T) {
+	tarball := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	gt.NoError(t, os.WriteFile(tarball, writeBundle(t, newTestBundle("v2.0.0")), 0600))
+
+	type testCase struct {
+		src      opac.Source
+		revision string
+		newErr   bool
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			client, err := opac.New(tc.src)
+			if tc.newErr {
+				gt.Error(t, err)
+				return
+			}
+			gt.NoError(t, err)
+			gt.Equal(t, client.Revision(), tc.revision)
+
+			type authzOutput struct {
+				Allow bool `json:"allow"`
+			}
+			ctx := context.Background()
+
+			var allowed authzOutput
+			gt.NoError(t, client.Query(ctx, "data.authz", map[string]any{"user": "alice"}, &allowed))
+			gt.True(t, allowed.Allow)
+
+			var denied authzOutput
+			gt.NoError(t, client.Query(ctx, "data.authz", map[string]any{"user": "bob"}, &denied))
+			gt.False(t, denied.Allow)
+		}
+	}
+
+	t.Run("directory", doTest(testCase{
+		src:      opac.Bundle("testdata/bundle"),
+		revision: "v1.2.3",
+	}))
+
+	t.Run("tarball", doTest(testCase{
+		src:      opac.Bundle(tarball),
+		revision: "v2.0.0",
+	}))
+
+	t.Run("reader", doTest(testCase{
+		src:      opac.BundleReader(bytes.NewReader(writeBundle(t, newTestBundle("v3.0.0")))),
+		revision: "v3.0.0",
+	}))
+
+	t.Run("not found", doTest(testCase{
+		src:    opac.Bundle("testdata/not_found.tar.gz"),
+		newErr: true,
+	}))
+
+	t.Run("invalid tarball", doTest(testCase{
+		src:    opac.BundleReader(bytes.NewReader([]byte("not a tarball"))),
+		newErr: true,
+	}))
+
+	t.Run("module out of manifest roots", doTest(testCase{
+		src:    opac.Bundle("testdata/bundle_out_of_root"),
+		newErr: true,
+	}))
+}
+
+func TestRevisionOfNonBundle(t *testing.T) {
+	client := gt.R1(opac.New(opac.Files("testdata/local"))).NoError(t)
+	gt.Equal(t, client.Revision(), "")
+}
+
+// signBundle adds .signatures.json to the bundle files. Files in exclude are not included in the signature.
+func signBundle(t *testing.T, files map[string]string, keyID, alg, key string, exclude ...string) map[string]string {
+	hasher := gt.R1(bundle.NewSignatureHasher(bundle.SHA256)).NoError(t)
+
+	var infos []bundle.FileInfo
+	for name, content := range files {
+		if slices.Contains(exclude, name) {
+			continue
+		}
+
+		var value any = []byte(content)
+		if bundle.IsStructuredDoc(name) {
+			gt.NoError(t, util.Unmarshal([]byte(content), &value))
+		}
+		digest := gt.R1(hasher.HashFile(value)).NoError(t)
+		infos = append(infos, bundle.NewFile(name, hex.EncodeToString(digest), string(bundle.SHA256)))
+	}
+
+	token := gt.R1(bundle.GenerateSignedToken(infos, bundle.NewSigningConfig(key, alg, ""), keyID)).NoError(t)
+	signed := maps.Clone(files)
+	signed[".signatures.json"] = `{"signatures": ["` + token + `"]}`
+	return signed
+}
+
+func TestBundleVerification(t *testing.T) {
+	rsaKey := gt.R1(rsa.GenerateKey(rand.Reader, 2048)).NoError(t)
+	privateKey := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+	}))
+	publicKey := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: gt.R1(x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)).NoError(t),
+	}))
+
+	ecKey := gt.R1(ecdsa.GenerateKey(elliptic.P256(), rand.Reader)).NoError(t)
+	ecPrivateKey := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: gt.R1(x509.MarshalECPrivateKey(ecKey)).NoError(t),
+	}))
+	ecPublicKey := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: gt.R1(x509.MarshalPKIXPublicKey(&ecKey.PublicKey)).NoError(t),
+	}))
+
+	type testCase struct {
+		files     map[string]string
+		options   []opac.BundleOption
+		verifyErr bool
+		err       error
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			src := opac.BundleReader(bytes.NewReader(writeBundle(t, tc.files)), tc.options...)
+			client, err := opac.New(src)
+			if tc.verifyErr {
+				var verifyErr *opac.BundleVerificationError
+				gt.True(t, errors.As(err, &verifyErr))
+				if tc.err != nil {
+					gt.True(t, errors.Is(err, tc.err))
+				}
+				return
+			}
+			gt.NoError(t, err)
+			gt.Equal(t, client.Revision(), "v1")
+		}
+	}
+
+	t.Run("RS256", doTest(testCase{
+		files:   signBundle(t, newTestBundle("v1"), "ci", "RS256", privateKey),
+		options: []opac.BundleOption{opac.WithVerificationKey("ci", "RS256", publicKey)},
+	}))
+
+	t.Run("ES256", doTest(testCase{
+		files:   signBundle(t, newTestBundle("v1"), "ci", "ES256", ecPrivateKey),
+		options: []opac.BundleOption{opac.WithVerificationKey("ci", "ES256", ecPublicKey)},
+	}))
+
+	t.Run("ES256 with RSA key", doTest(testCase{
+		files:     signBundle(t, newTestBundle("v1"), "ci", "ES256", ecPrivateKey),
+		options:   []opac.BundleOption{opac.WithVerificationKey("ci", "ES256", publicKey)},
+		verifyErr: true,
+	}))
+
+	t.Run("HS256", doTest(testCase{
+		files:   signBundle(t, newTestBundle("v1"), "ci", "HS256", "secret"),
+		options: []opac.BundleOption{opac.WithVerificationKey("ci", "HS256", "secret")},
+	}))
+
+	t.Run("no verification key", doTest(testCase{
+		files: signBundle(t, newTestBundle("v1"), "ci", "HS256", "secret"),
+	}))
+
+	t.Run("missing signature", doTest(testCase{
+		files:     newTestBundle("v1"),
+		options:   []opac.BundleOption{opac.WithVerificationKey("ci", "HS256", "secret")},
+		verifyErr: true,
+		err:       opac.ErrMissingBundleSignature,
+	}))
+
+	t.Run("invalid key", doTest(testCase{
+		files:     signBundle(t, newTestBundle("v1"), "ci", "HS256", "secret"),
+		options:   []opac.BundleOption{opac.WithVerificationKey("ci", "HS256", "another secret")},
+		verifyErr: true,
+	}))
+
+	t.Run("unknown key ID", doTest(testCase{
+		files:     signBundle(t, newTestBundle("v1"), "ci", "HS256", "secret"),
+		options:   []opac.BundleOption{opac.WithVerificationKey("other", "HS256", "secret")},
+		verifyErr: true,
+	}))
+
+	t.Run("file not covered", doTest(testCase{
+		files:     signBundle(t, newTestBundle("v1"), "ci", "HS256", "secret", "roles/data.json"),
+		options:   []opac.BundleOption{opac.WithVerificationKey("ci", "HS256", "secret")},
+		verifyErr: true,
+	}))
+
+	t.Run("tampered file", doTest(testCase{
+		files: func() map[string]string {
+			files := signBundle(t, newTestBundle("v1"), "ci", "HS256", "secret")
+			files["roles/data.json"] = `{"bob": "admin"}`
+			return files
+		}(),
+		options:   []opac.BundleOption{opac.WithVerificationKey("ci", "HS256", "secret")},
+		verifyErr: true,
+	}))
+
+	t.Run("scope without verification key", doTest(testCase{
+		files:   newTestBundle("v1"),
+		options: []opac.BundleOption{opac.WithVerificationScope("write")},
+	}))
+
+	t.Run("scope mismatch", doTest(testCase{
+		files: signBundle(t, newTestBundle("v1"), "ci", "HS256", "secret"),
+		options: []opac.BundleOption{
+			opac.WithVerificationKey("ci", "HS256", "secret"),
+			opac.WithVerificationScope("write"),
+		},
+		verifyErr: true,
+	}))
+}
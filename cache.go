@@ -0,0 +1,113 @@
+package opac
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// defaultQueryCacheSize is the default number of prepared queries kept by a local source.
+const defaultQueryCacheSize = 128
+
+// WithQueryCacheSize sets the maximum number of prepared queries cached by a local source (Files or Data). Prepared queries are keyed by query string and evicted in least recently used order. Zero or a negative value disables the cache. The default size is 128.
+func WithQueryCacheSize(size int) Option {
+	return func(cfg *config) {
+		cfg.queryCacheSize = size
+	}
+}
+
+// queryCache is a bounded LRU cache of prepared queries. The cache is bound to the current policy set (compiler and store) of the source, and all entries are discarded only when the source swaps the policy set by reset, so that prepared queries never outlive the policies they are compiled against. Queries still evaluated with a superseded policy set during a reload neither hit nor purge the cache.
+type queryCache struct {
+	mutex    sync.Mutex
+	size     int
+	policies *policySet
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type queryCacheEntry struct {
+	query    string
+	prepared rego.PreparedEvalQuery
+}
+
+func newQueryCache(size int, policies *policySet) *queryCache {
+	return &queryCache{
+		size:     size,
+		policies: policies,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// reset discards all entries and binds the cache to the new policy set.
+func (c *queryCache) reset(policies *policySet) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+	c.policies = policies
+}
+
+// enabled returns true if the cache stores prepared queries.
+func (c *queryCache) enabled() bool {
+	return c != nil && c.size > 0
+}
+
+// get returns the prepared query for the query string if it is cached for the policy set.
+func (c *queryCache) get(policies *policySet, query string) (rego.PreparedEvalQuery, bool) {
+	if c == nil || c.size <= 0 {
+		return rego.PreparedEvalQuery{}, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.policies != policies {
+		return rego.PreparedEvalQuery{}, false
+	}
+
+	elem, ok := c.entries[query]
+	if !ok {
+		return rego.PreparedEvalQuery{}, false
+	}
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*queryCacheEntry).prepared, true
+}
+
+// put stores the prepared query. It is ignored if the policy set is not the current one of the cache.
+func (c *queryCache) put(policies *policySet, query string, prepared rego.PreparedEvalQuery) {
+	if c == nil || c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.policies != policies {
+		return
+	}
+
+	if elem, ok := c.entries[query]; ok {
+		elem.Value.(*queryCacheEntry).prepared = prepared
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[query] = c.order.PushFront(&queryCacheEntry{
+		query:    query,
+		prepared: prepared,
+	})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*queryCacheEntry).query)
+	}
+}
@@ -0,0 +1,108 @@
+package opac_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+func TestQueryCache(t *testing.T) {
+	policy := `package color
+
+number := 5 if { input.color == "blue" }
+number := 3 if { input.color == "white" }
+name := input.color
+`
+	queries := []string{"data.color", "data.color.number", "data.color.name"}
+
+	doTest := func(options ...opac.Option) func(t *testing.T) {
+		return func(t *testing.T) {
+			client := gt.R1(opac.New(
+				opac.Data(map[string]string{"policy.rego": policy}),
+				options...,
+			)).NoError(t)
+
+			ctx := context.Background()
+			var wg sync.WaitGroup
+			for i := 0; i < 64; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					color := []string{"blue", "white"}[i%2]
+					input := map[string]any{"color": color}
+
+					var output any
+					gt.NoError(t, client.Query(ctx, queries[i%len(queries)], input, &output))
+
+					switch i % len(queries) {
+					case 0:
+						v := output.(map[string]any)
+						gt.Equal(t, v["name"], any(color))
+					case 1:
+						gt.Equal(t, fmt.Sprint(output), map[string]string{"blue": "5", "white": "3"}[color])
+					case 2:
+						gt.Equal(t, output, any(color))
+					}
+				}(i)
+			}
+			wg.Wait()
+		}
+	}
+
+	t.Run("default size", doTest())
+	t.Run("evict entries", doTest(opac.WithQueryCacheSize(1)))
+	t.Run("disabled", doTest(opac.WithQueryCacheSize(0)))
+}
+
+func TestQueryCacheInvalidQuery(t *testing.T) {
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": "package color\nnumber := 5"}),
+	)).NoError(t)
+
+	ctx := context.Background()
+	var output any
+	gt.Error(t, client.Query(ctx, "data.color[", nil, &output))
+
+	// invalid query must not be cached
+	gt.Error(t, client.Query(ctx, "data.color[", nil, &output))
+	gt.NoError(t, client.Query(ctx, "data.color.number", nil, &output))
+	gt.Equal(t, output, any(float64(5)))
+}
+
+func TestQueryCacheHit(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "policy.rego"), "package color\n\nnumber := 5\n")
+
+	recorder := &metricsRecorder{}
+	events := make(chan opac.ReloadEvent, 16)
+	client := gt.R1(opac.New(
+		opac.Files(dir),
+		opac.WithMetrics(recorder),
+		opac.WithWatch(10*time.Millisecond),
+		opac.WithReloadCallback(func(event opac.ReloadEvent) { events <- event }),
+	)).NoError(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	var output int
+	gt.NoError(t, client.Query(ctx, "data.color.number", nil, &output))
+	gt.NoError(t, client.Query(ctx, "data.color.number", nil, &output))
+	gt.Equal(t, output, 5)
+
+	// Entries are discarded once by reloading, then the new policies are cached
+	writeFile(t, filepath.Join(dir, "policy.rego"), "package color\n\nnumber := 3\n")
+	gt.NoError(t, waitReload(t, events).Err)
+	gt.NoError(t, client.Query(ctx, "data.color.number", nil, &output))
+	gt.NoError(t, client.Query(ctx, "data.color.number", nil, &output))
+	gt.Equal(t, output, 3)
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	gt.Equal(t, recorder.cache, []bool{false, true, false, true})
+}
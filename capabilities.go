@@ -0,0 +1,156 @@
+package opac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// WithCapabilities sets OPA capabilities for local sources (Files, Data, FS and Bundle). Policies and queries calling a built-in function that is not in the capabilities fail to compile with *CompileError naming the call and its location. Custom built-in functions registered by WithBuiltin are always available. Remote source ignores the option because capabilities must be set in OPA server.
+//
+// Example:
+//
+//	caps, err := ast.LoadCapabilitiesVersion("v0.70.0")
+//	client, err := opac.New(opac.Data(policies), opac.WithCapabilities(caps))
+func WithCapabilities(caps *ast.Capabilities) Option {
+	return func(cfg *config) {
+		cfg.capabilitiesConfig().base = caps
+	}
+}
+
+// WithCapabilitiesFile sets OPA capabilities read from the JSON file, such as a file generated by `opa capabilities`. See WithCapabilities for details.
+func WithCapabilitiesFile(path string) Option {
+	return func(cfg *config) {
+		cfg.capabilitiesConfig().file = path
+	}
+}
+
+// WithAllowedBuiltins restricts built-in functions of local sources to the given names, such as "count" and "startswith". Operators (e.g. ==, :=) and internal functions of OPA are always allowed. It is applied to the capabilities set by WithCapabilities or WithCapabilitiesFile, or to the capabilities of the OPA version in use. An unknown name is an error of opac.New.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Data(policies), opac.WithAllowedBuiltins("count", "startswith", "time.parse_rfc3339_ns"))
+func WithAllowedBuiltins(names ...string) Option {
+	return func(cfg *config) {
+		c := cfg.capabilitiesConfig()
+		c.allowed = append(c.allowed, names...)
+	}
+}
+
+// WithDeniedBuiltins removes the given built-in functions from local sources, such as "http.send", "net.lookup_ip_addr", "opa.runtime" and "time.now_ns". It is applied after WithAllowedBuiltins. An unknown name is an error of opac.New.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Data(policies), opac.WithDeniedBuiltins("http.send", "net.lookup_ip_addr", "opa.runtime", "time.now_ns"))
+func WithDeniedBuiltins(names ...string) Option {
+	return func(cfg *config) {
+		c := cfg.capabilitiesConfig()
+		c.denied = append(c.denied, names...)
+	}
+}
+
+// capabilities is the configuration of capabilities. caps is resolved from other fields by resolve.
+type capabilities struct {
+	base    *ast.Capabilities
+	file    string
+	allowed []string
+	denied  []string
+	caps    *ast.Capabilities
+}
+
+func (cfg *config) capabilitiesConfig() *capabilities {
+	if cfg.capabilities == nil {
+		cfg.capabilities = &capabilities{}
+	}
+	return cfg.capabilities
+}
+
+// resolve creates the capabilities for the compiler. It does nothing if no capabilities option is set.
+func (c *capabilities) resolve() error {
+	if c == nil {
+		return nil
+	}
+
+	base := c.base
+	if c.file != "" {
+		loaded, err := ast.LoadCapabilitiesFile(c.file)
+		if err != nil {
+			return fmt.Errorf("failed to load capabilities file %s: %w", c.file, err)
+		}
+		base = loaded
+	}
+	if base == nil {
+		base = ast.CapabilitiesForThisVersion()
+	}
+
+	known := make(map[string]struct{}, len(base.Builtins))
+	for _, bi := range base.Builtins {
+		known[bi.Name] = struct{}{}
+	}
+	toSet := func(names []string) (map[string]struct{}, error) {
+		set := make(map[string]struct{}, len(names))
+		for _, name := range names {
+			if _, ok := known[name]; !ok {
+				return nil, fmt.Errorf("unknown built-in function in capabilities: %s", name)
+			}
+			set[name] = struct{}{}
+		}
+		return set, nil
+	}
+	allowed, err := toSet(c.allowed)
+	if err != nil {
+		return err
+	}
+	denied, err := toSet(c.denied)
+	if err != nil {
+		return err
+	}
+
+	// Copy the capabilities not to modify the given one
+	caps := *base
+	caps.Builtins = make([]*ast.Builtin, 0, len(base.Builtins))
+	for _, bi := range base.Builtins {
+		if _, ok := denied[bi.Name]; ok {
+			continue
+		}
+		if len(allowed) > 0 && !isImplicitBuiltin(bi) {
+			if _, ok := allowed[bi.Name]; !ok {
+				continue
+			}
+		}
+		caps.Builtins = append(caps.Builtins, bi)
+	}
+
+	c.caps = &caps
+	return nil
+}
+
+// isImplicitBuiltin returns true if the built-in function is an operator or an internal function that is called without its name in policies.
+func isImplicitBuiltin(bi *ast.Builtin) bool {
+	return bi.Infix != "" || strings.HasPrefix(bi.Name, "internal.")
+}
+
+// explainForbiddenCalls rewrites compile errors of calls to built-in functions of OPA that are removed by the capabilities, so that the error tells why the function is undefined.
+func (c *capabilities) explainForbiddenCalls(err error) {
+	if c == nil || c.caps == nil {
+		return
+	}
+
+	var astErrs ast.Errors
+	if !errors.As(err, &astErrs) {
+		return
+	}
+
+	const prefix = "undefined function "
+	for _, astErr := range astErrs {
+		if astErr.Code != ast.TypeErr || !strings.HasPrefix(astErr.Message, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(astErr.Message, prefix)
+		if _, ok := ast.BuiltinMap[name]; ok {
+			astErr.Message = fmt.Sprintf("function %s is not allowed by capabilities", name)
+		}
+	}
+}
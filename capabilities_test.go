@@ -0,0 +1,120 @@
+package opac_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+const sandboxPolicy = `package authz
+
+allow if {
+	count(input.roles) > 0
+	startswith(input.user, "admin-")
+}
+`
+
+const httpPolicy = `package authz
+
+allow if {
+	resp := http.send({"method": "get", "url": "https://example.com"})
+	resp.status_code == 200
+}
+`
+
+func TestCapabilities(t *testing.T) {
+	ctx := context.Background()
+	input := map[string]any{"user": "admin-alice", "roles": []string{"admin"}}
+
+	compileError := func(t *testing.T, err error) *opac.CompileError {
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+		gt.A(t, compileErr.Errors).Length(1)
+		return compileErr
+	}
+
+	t.Run("denied built-in in policy", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": httpPolicy}),
+			opac.WithDeniedBuiltins("http.send", "net.lookup_ip_addr", "opa.runtime", "time.now_ns"),
+		)
+		compileErr := compileError(t, err)
+		gt.Equal(t, compileErr.Errors[0].Message, "function http.send is not allowed by capabilities")
+		gt.Equal(t, compileErr.Errors[0].Location.File, "policy.rego")
+		gt.Equal(t, compileErr.Errors[0].Location.Row, 4)
+	})
+
+	t.Run("denied built-in in query", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": sandboxPolicy}),
+			opac.WithDeniedBuiltins("time.now_ns"),
+		)).NoError(t)
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", input)).NoError(t))
+
+		_, err := opac.QueryAs[int64](ctx, client, "time.now_ns()", nil)
+		gt.Equal(t, compileError(t, err).Errors[0].Message, "function time.now_ns is not allowed by capabilities")
+	})
+
+	t.Run("allowed built-ins", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": sandboxPolicy}),
+			opac.WithAllowedBuiltins("count", "startswith"),
+		)).NoError(t)
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", input)).NoError(t))
+
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": sandboxPolicy}),
+			opac.WithAllowedBuiltins("count"),
+		)
+		gt.Equal(t, compileError(t, err).Errors[0].Message, "function startswith is not allowed by capabilities")
+	})
+
+	t.Run("custom built-in is allowed", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": builtinPolicy}),
+			parseID, opac.WithAllowedBuiltins("count"),
+		)).NoError(t)
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", map[string]any{"id": "tenant1:user1"})).NoError(t))
+	})
+
+	t.Run("capabilities file", func(t *testing.T) {
+		caps := ast.CapabilitiesForThisVersion()
+		var builtins []*ast.Builtin
+		for _, bi := range caps.Builtins {
+			if bi.Name != "http.send" {
+				builtins = append(builtins, bi)
+			}
+		}
+		caps.Builtins = builtins
+
+		path := filepath.Join(t.TempDir(), "capabilities.json")
+		gt.NoError(t, os.WriteFile(path, gt.R1(json.Marshal(caps)).NoError(t), 0644))
+
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": httpPolicy}), opac.WithCapabilitiesFile(path))
+		gt.Equal(t, compileError(t, err).Errors[0].Message, "function http.send is not allowed by capabilities")
+
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": sandboxPolicy}), opac.WithCapabilitiesFile(path))).NoError(t)
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", input)).NoError(t))
+	})
+
+	t.Run("capabilities are not modified", func(t *testing.T) {
+		caps := ast.CapabilitiesForThisVersion()
+		n := len(caps.Builtins)
+		gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": sandboxPolicy}),
+			opac.WithCapabilities(caps), opac.WithDeniedBuiltins("http.send"),
+		)).NoError(t)
+		gt.Equal(t, len(caps.Builtins), n)
+	})
+
+	t.Run("unknown built-in", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": sandboxPolicy}), opac.WithDeniedBuiltins("http.sendd"))
+		gt.Error(t, err)
+	})
+
+	t.Run("missing capabilities file", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": sandboxPolicy}), opac.WithCapabilitiesFile("testdata/no_such_file.json"))
+		gt.Error(t, err)
+	})
+}
@@ -0,0 +1,158 @@
+package opac
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// WithRegoVersion sets the default Rego syntax version of policies for local sources, ast.RegoV1 or ast.RegoV0. It is used for all modules of Files, FS and Data sources unless WithPathRegoVersion matches the module, and for modules of Bundle and BundleServer sources unless the manifest specifies the version. The default is ast.RegoV1.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Files("legacy_policy"), opac.WithRegoVersion(ast.RegoV0))
+func WithRegoVersion(version ast.RegoVersion) Option {
+	return func(cfg *config) {
+		cfg.regoVersion = version
+	}
+}
+
+// WithPathRegoVersion sets the Rego syntax version of modules under the path prefix for Files, FS and Data sources. The prefix is matched with the file path (or the key of Data) by directory, e.g. "policy/legacy" matches "policy/legacy/authz.rego" but not "policy/legacy2/authz.rego". The longest matched prefix is used when prefixes are nested.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Files("policy"),
+//		opac.WithPathRegoVersion("policy/legacy", ast.RegoV0),
+//	)
+func WithPathRegoVersion(prefix string, version ast.RegoVersion) Option {
+	return func(cfg *config) {
+		cfg.regoVersions = append(cfg.regoVersions, pathRegoVersion{
+			prefix:  filepath.ToSlash(filepath.Clean(prefix)),
+			version: version,
+		})
+	}
+}
+
+// WithStrict enables strict mode of the Rego compiler for local sources. Policies fail to compile with *CompileError if they have unused local variables, unused imports, deprecated built-in functions, shadowed input or data and other issues checked by strict mode. Use WithCompileWarnings to report the issues without failing instead.
+func WithStrict(strict bool) Option {
+	return func(cfg *config) {
+		cfg.strict = strict
+	}
+}
+
+// WithCompileWarnings reports issues checked by strict mode of the Rego compiler as warnings while strict mode is disabled. The warnings are logged at WARN level and returned by Client.Warnings every time policies are compiled, including reloading. Policies are compiled twice to find the warnings, so it increases the time of loading policies. It does nothing if strict mode is enabled by WithStrict.
+func WithCompileWarnings() Option {
+	return func(cfg *config) {
+		cfg.compileWarnings = true
+	}
+}
+
+// Warnings returns warnings of compiling the current policies of local sources. Warnings are collected only if WithCompileWarnings is set. It returns nil if there is no warning or the source is Remote.
+func (c *Client) Warnings() []*RegoError {
+	return c.src.Warnings()
+}
+
+type pathRegoVersion struct {
+	prefix  string
+	version ast.RegoVersion
+}
+
+// validateRegoVersions checks the Rego versions set by options.
+func validateRegoVersions(cfg *config) error {
+	versions := []ast.RegoVersion{cfg.regoVersion}
+	for _, v := range cfg.regoVersions {
+		versions = append(versions, v.version)
+	}
+
+	for _, v := range versions {
+		switch v {
+		case ast.RegoV0, ast.RegoV0CompatV1, ast.RegoV1:
+		default:
+			return fmt.Errorf("invalid Rego version: %d", v)
+		}
+	}
+	return nil
+}
+
+// regoVersionOf returns the Rego version of the module by the longest matched path prefix.
+func (cfg *config) regoVersionOf(name string) ast.RegoVersion {
+	name = filepath.ToSlash(filepath.Clean(name))
+
+	version, matched := cfg.regoVersion, -1
+	for _, v := range cfg.regoVersions {
+		if len(v.prefix) <= matched {
+			continue
+		}
+		if v.prefix == "." || name == v.prefix || strings.HasPrefix(name, v.prefix+"/") {
+			version, matched = v.version, len(v.prefix)
+		}
+	}
+	return version
+}
+
+// compilePolicies parses and compiles policy modules of Files, FS and Data sources. The keys of modules are used as file names.
+func compilePolicies(cfg *config, modules map[string]string) (*ast.Compiler, []*RegoError, error) {
+	parsed := make(map[string]*ast.Module, len(modules))
+	for name, module := range modules {
+		m, err := ast.ParseModuleWithOpts(name, module, ast.ParserOptions{
+			ProcessAnnotation: true,
+			RegoVersion:       cfg.regoVersionOf(name),
+		})
+		if err != nil {
+			return nil, nil, newCompileError("failed to compile policy", err)
+		}
+		parsed[name] = m
+	}
+
+	return compileModules(cfg, parsed)
+}
+
+// compileModules compiles parsed modules with the compiler settings common to local sources. If warnings are enabled and strict mode is disabled, issues of strict mode are returned as warnings.
+func compileModules(cfg *config, modules map[string]*ast.Module) (*ast.Compiler, []*RegoError, error) {
+	var strictModules map[string]*ast.Module
+	if cfg.compileWarnings && !cfg.strict {
+		// Modules are modified by compiling, so they are copied before compiling for warnings
+		strictModules = make(map[string]*ast.Module, len(modules))
+		for name, m := range modules {
+			strictModules[name] = m.Copy()
+		}
+	}
+
+	compiler := newCompiler(cfg, cfg.strict)
+	compiler.Compile(modules)
+	if compiler.Failed() {
+		cfg.capabilities.explainForbiddenCalls(compiler.Errors)
+		return nil, nil, newCompileError("failed to compile policy", compiler.Errors)
+	}
+
+	if strictModules == nil {
+		return compiler, nil, nil
+	}
+
+	strictCompiler := newCompiler(cfg, true)
+	strictCompiler.Compile(strictModules)
+	warnings := newRegoErrors(strictCompiler.Errors)
+	sort.Slice(warnings, func(i, j int) bool {
+		return warnings[i].String() < warnings[j].String()
+	})
+	for _, w := range warnings {
+		cfg.logger.Warn("Policy compile warning", "warning", w.String())
+	}
+
+	return compiler, warnings, nil
+}
+
+func newCompiler(cfg *config, strict bool) *ast.Compiler {
+	compiler := ast.NewCompiler().
+		WithDefaultRegoVersion(cfg.regoVersion).
+		WithEnablePrintStatements(true).
+		WithStrict(strict).
+		WithBuiltins(builtinDecls(cfg.builtins))
+	if cfg.capabilities != nil {
+		compiler = compiler.WithCapabilities(cfg.capabilities.caps)
+	}
+	return compiler
+}
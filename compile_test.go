@@ -0,0 +1,138 @@
+package opac_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+const v0Policy = `package authz
+
+allow {
+	input.user == "admin"
+}
+`
+
+const v1Policy = `package authz
+
+allow if {
+	input.user == "admin"
+}
+`
+
+func TestRegoVersion(t *testing.T) {
+	ctx := context.Background()
+	input := map[string]any{"user": "admin"}
+
+	isCompileError := func(t *testing.T, err error) {
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+	}
+
+	t.Run("v1 by default for all sources", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": v0Policy}))
+		isCompileError(t, err)
+
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "policy.rego"), v0Policy)
+		_, err = opac.New(opac.Files(dir))
+		isCompileError(t, err)
+	})
+
+	t.Run("v0", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "policy.rego"), v0Policy)
+
+		sources := []opac.Source{
+			opac.Data(map[string]string{"policy.rego": v0Policy}),
+			opac.Files(dir),
+		}
+		for _, src := range sources {
+			client := gt.R1(opac.New(src, opac.WithRegoVersion(ast.RegoV0))).NoError(t)
+			gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", input)).NoError(t))
+		}
+
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": v1Policy}), opac.WithRegoVersion(ast.RegoV0))
+		isCompileError(t, err)
+	})
+
+	t.Run("v0 bundle", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "authz", "policy.rego"), v0Policy)
+
+		client := gt.R1(opac.New(opac.Bundle(dir), opac.WithRegoVersion(ast.RegoV0))).NoError(t)
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", input)).NoError(t))
+	})
+
+	t.Run("by path", func(t *testing.T) {
+		policies := map[string]string{
+			"policy/legacy/authz.rego":         v0Policy,
+			"policy/legacy/current/authz.rego": strings.Replace(v1Policy, "package authz", "package authz.current", 1),
+			"policy/legacy2/authz.rego":        strings.Replace(v1Policy, "package authz", "package authz2", 1),
+		}
+		client := gt.R1(opac.New(opac.Data(policies),
+			opac.WithPathRegoVersion("policy/legacy", ast.RegoV0),
+			opac.WithPathRegoVersion("policy/legacy/current", ast.RegoV1),
+		)).NoError(t)
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", input)).NoError(t))
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.current.allow", input)).NoError(t))
+		gt.True(t, gt.R1(opac.QueryAs[bool](ctx, client, "data.authz2.allow", input)).NoError(t))
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": v1Policy}), opac.WithRegoVersion(ast.RegoUndefined))
+		gt.Error(t, err)
+	})
+}
+
+func TestStrict(t *testing.T) {
+	policy := `package authz
+
+allow if {
+	x := input.role
+	input.user == "admin"
+}
+`
+
+	t.Run("strict mode", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{"policy.rego": policy}), opac.WithStrict(true))
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+		gt.A(t, compileErr.Errors).Length(1)
+		gt.Equal(t, compileErr.Errors[0].Location.Row, 4)
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		w := &logWriter{buf: new(bytes.Buffer)}
+		logger := slog.New(slog.NewJSONHandler(w, nil))
+
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}), opac.WithLogger(logger), opac.WithCompileWarnings())).NoError(t)
+		warnings := client.Warnings()
+		gt.A(t, warnings).Length(1)
+		gt.Equal(t, warnings[0].Code, "rego_compile_error")
+		gt.Equal(t, warnings[0].Location.File, "policy.rego")
+		gt.Equal(t, warnings[0].Location.Row, 4)
+		gt.True(t, strings.Contains(w.buf.String(), `"level":"WARN","msg":"Policy compile warning"`))
+
+		allowed := gt.R1(opac.QueryAs[bool](context.Background(), client, "data.authz.allow", map[string]any{"user": "admin", "role": "owner"})).NoError(t)
+		gt.True(t, allowed)
+	})
+
+	t.Run("no warning", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": v1Policy}), opac.WithCompileWarnings())).NoError(t)
+		gt.A(t, client.Warnings()).Length(0)
+	})
+
+	t.Run("warnings are disabled by default", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}))).NoError(t)
+		gt.A(t, client.Warnings()).Length(0)
+	})
+}
@@ -0,0 +1,434 @@
+package opac
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDecisionLogBufferSize  = 1024
+	defaultDecisionLogBatchSize   = 100
+	defaultDecisionLogHTTPTimeout = 10 * time.Second
+)
+
+// DecisionLog is an entry of the decision log. It is recorded for every Client.Query and Client.QueryResultSet call.
+type DecisionLog struct {
+	DecisionID string        `json:"decision_id"`
+	Query      string        `json:"query"`
+	Input      any           `json:"input,omitempty"`
+	Result     any           `json:"result,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Source     string        `json:"source"`
+	Revision   string        `json:"revision,omitempty"`
+	Path       DecisionPath  `json:"decision_path"`
+	Erased     []string      `json:"erased,omitempty"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Latency    time.Duration `json:"latency"`
+}
+
+// DecisionSink receives decision logs in background. Write is called from a single goroutine, so it does not need to be safe for concurrent use.
+type DecisionSink interface {
+	Write(ctx context.Context, logs []*DecisionLog) error
+}
+
+// DecisionLogOption is a function that configures the decision logger.
+type DecisionLogOption func(*decisionLogConfig)
+
+type decisionLogConfig struct {
+	sink       DecisionSink
+	bufferSize int
+	batchSize  int
+}
+
+// WithDecisionLogger enables decision logging to the sink. Inputs and results are masked with WithMask and WithMaskFunc. Decision logs are queued and delivered to the sink asynchronously, and they are dropped when the queue is full so that queries are never blocked. Client.Close flushes queued logs. Counters of delivered and dropped logs are available with Client.DecisionLogStats.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Files("policy"),
+//		opac.WithDecisionLogger(opac.SlogSink(logger)),
+//		opac.WithMask("/input/password"),
+//	)
+func WithDecisionLogger(sink DecisionSink, options ...DecisionLogOption) Option {
+	return func(cfg *config) {
+		dl := &decisionLogConfig{
+			sink:       sink,
+			bufferSize: defaultDecisionLogBufferSize,
+			batchSize:  defaultDecisionLogBatchSize,
+		}
+		for _, opt := range options {
+			opt(dl)
+		}
+		cfg.decisionLog = dl
+	}
+}
+
+// WithDecisionLogBufferSize sets the number of decision logs queued for the sink. The default is 1024.
+func WithDecisionLogBufferSize(size int) DecisionLogOption {
+	return func(cfg *decisionLogConfig) {
+		cfg.bufferSize = size
+	}
+}
+
+// WithDecisionLogBatchSize sets the maximum number of decision logs given to the sink at once. The default is 100.
+func WithDecisionLogBatchSize(size int) DecisionLogOption {
+	return func(cfg *decisionLogConfig) {
+		cfg.batchSize = size
+	}
+}
+
+// DecisionLogStats is counters of the decision logger.
+type DecisionLogStats struct {
+	// Written is the number of logs delivered to the sink successfully.
+	Written uint64
+
+	// Dropped is the number of logs dropped because the queue was full or the client was closed.
+	Dropped uint64
+
+	// Failed is the number of logs that the sink failed to write.
+	Failed uint64
+}
+
+// DecisionLogStats returns counters of the decision logger. It returns zero values if decision logging is not enabled.
+func (c *Client) DecisionLogStats() DecisionLogStats {
+	if c.decisionLogger == nil {
+		return DecisionLogStats{}
+	}
+	return DecisionLogStats{
+		Written: c.decisionLogger.written.Load(),
+		Dropped: c.decisionLogger.dropped.Load(),
+		Failed:  c.decisionLogger.failed.Load(),
+	}
+}
+
+// decisionLogger delivers decision logs to the sink in background.
+type decisionLogger struct {
+	cfg    *decisionLogConfig
+	logger *slog.Logger
+	masker *masker
+	queue  chan *DecisionLog
+	mutex  sync.RWMutex
+	closed bool
+	done   chan struct{}
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+func newDecisionLogger(cfg *decisionLogConfig, logger *slog.Logger, masker *masker) *decisionLogger {
+	bufferSize := max(cfg.bufferSize, 1)
+	d := &decisionLogger{
+		cfg:    cfg,
+		logger: logger,
+		masker: masker,
+		queue:  make(chan *DecisionLog, bufferSize),
+		done:   make(chan struct{}),
+	}
+
+	go d.run()
+	return d
+}
+
+// record masks the entry and queues it. It never blocks, and the entry is dropped if the queue is full.
+func (d *decisionLogger) record(entry *DecisionLog) {
+	if d == nil {
+		return
+	}
+
+	entry.DecisionID = uuid.NewString()
+	d.mask(entry)
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.closed {
+		d.dropped.Add(1)
+		return
+	}
+
+	select {
+	case d.queue <- entry:
+	default:
+		d.dropped.Add(1)
+		d.logger.Debug("Decision log is dropped", "decision_id", entry.DecisionID)
+	}
+}
+
+// mask copies input and result of the entry and removes masked paths from them. The copy also prevents the caller from modifying the values while they are queued.
+func (d *decisionLogger) mask(entry *DecisionLog) {
+	doc := map[string]any{}
+	for key, value := range map[string]any{"input": entry.Input, "result": entry.Result} {
+		if value == nil {
+			continue
+		}
+		copied, err := toJSONValue(value)
+		if err != nil {
+			d.logger.Warn("Failed to copy value for decision log", "key", key, "error", err)
+			continue
+		}
+		doc[key] = copied
+	}
+
+	entry.Erased = d.masker.apply(doc)
+
+	entry.Input = doc["input"]
+	entry.Result = doc["result"]
+}
+
+func (d *decisionLogger) run() {
+	defer close(d.done)
+
+	batchSize := max(d.cfg.batchSize, 1)
+	for entry := range d.queue {
+		batch := []*DecisionLog{entry}
+	drain:
+		for len(batch) < batchSize {
+			select {
+			case next, ok := <-d.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+
+		if err := d.cfg.sink.Write(context.Background(), batch); err != nil {
+			d.failed.Add(uint64(len(batch)))
+			d.logger.Error("Failed to write decision logs", "count", len(batch), "error", err)
+			continue
+		}
+		d.written.Add(uint64(len(batch)))
+	}
+}
+
+// close stops accepting new logs and waits until queued logs are delivered to the sink.
+func (d *decisionLogger) close() {
+	if d == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mutex.Unlock()
+
+	<-d.done
+}
+
+// toJSONValue converts the value into the types produced by JSON decoding into `any`.
+func toJSONValue(value any) (any, error) {
+	value, err := inputValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted any
+	if err := decodeResult(value, &converted); err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
+
+type slogSink struct {
+	logger *slog.Logger
+}
+
+// SlogSink returns a sink that writes each decision log to the logger at INFO level.
+func SlogSink(logger *slog.Logger) DecisionSink {
+	return &slogSink{logger: logger}
+}
+
+// Write implements DecisionSink.
+func (s *slogSink) Write(ctx context.Context, logs []*DecisionLog) error {
+	for _, log := range logs {
+		attrs := []any{
+			"decision_id", log.DecisionID,
+			"query", log.Query,
+			"input", log.Input,
+			"result", log.Result,
+			"source", log.Source,
+			"revision", log.Revision,
+			"decision_path", log.Path,
+			"latency", log.Latency,
+		}
+		if log.Error != "" {
+			attrs = append(attrs, "error", log.Error)
+		}
+		if len(log.Erased) > 0 {
+			attrs = append(attrs, "erased", log.Erased)
+		}
+		s.logger.InfoContext(ctx, "Decision", attrs...)
+	}
+	return nil
+}
+
+type jsonLinesSink struct {
+	w io.Writer
+}
+
+// JSONLinesSink returns a sink that writes each decision log as a line of JSON to the writer, such as a file opened with os.OpenFile.
+//
+// Example:
+//
+//	f, err := os.OpenFile("decision.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+//	client, err := opac.New(src, opac.WithDecisionLogger(opac.JSONLinesSink(f)))
+func JSONLinesSink(w io.Writer) DecisionSink {
+	return &jsonLinesSink{w: w}
+}
+
+// Write implements DecisionSink.
+func (s *jsonLinesSink) Write(ctx context.Context, logs []*DecisionLog) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, log := range logs {
+		if err := encoder.Encode(log); err != nil {
+			return fmt.Errorf("failed to encode decision log: %w", err)
+		}
+	}
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write decision logs: %w", err)
+	}
+	return nil
+}
+
+// HTTPSinkOption is a function that configures the sink created by HTTPSink.
+type HTTPSinkOption func(*httpSink)
+
+// WithSinkHTTPClient sets the HTTP client of the sink. The default client has 10 seconds timeout.
+func WithSinkHTTPClient(client HTTPClient) HTTPSinkOption {
+	return func(s *httpSink) {
+		s.httpClient = client
+	}
+}
+
+// WithSinkLabels sets labels included in every event sent by the sink.
+func WithSinkLabels(labels map[string]string) HTTPSinkOption {
+	return func(s *httpSink) {
+		s.labels = labels
+	}
+}
+
+type httpSink struct {
+	url        string
+	httpClient HTTPClient
+	labels     map[string]string
+}
+
+// HTTPSink returns a sink that sends decision logs to the URL in the format of the OPA decision log API: a gzip compressed JSON array of events sent by POST. It can be used with a decision log service of OPA, such as a server receiving `/logs` of OPA.
+func HTTPSink(url string, options ...HTTPSinkOption) DecisionSink {
+	s := &httpSink{
+		url:        url,
+		httpClient: &http.Client{Timeout: defaultDecisionLogHTTPTimeout},
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+// opaDecisionEvent is an event of the OPA decision log API.
+type opaDecisionEvent struct {
+	Labels     map[string]string `json:"labels,omitempty"`
+	DecisionID string            `json:"decision_id"`
+	Revision   string            `json:"revision,omitempty"`
+	Path       string            `json:"path,omitempty"`
+	Query      string            `json:"query,omitempty"`
+	Input      any               `json:"input,omitempty"`
+	Result     any               `json:"result,omitempty"`
+	Erased     []string          `json:"erased,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Metrics    map[string]int64  `json:"metrics,omitempty"`
+}
+
+// Write implements DecisionSink.
+func (s *httpSink) Write(ctx context.Context, logs []*DecisionLog) error {
+	events := make([]*opaDecisionEvent, 0, len(logs))
+	for _, log := range logs {
+		event := &opaDecisionEvent{
+			Labels:     s.labels,
+			DecisionID: log.DecisionID,
+			Revision:   log.Revision,
+			Input:      log.Input,
+			Result:     log.Result,
+			Erased:     log.Erased,
+			Error:      log.Error,
+			Timestamp:  log.Timestamp,
+			Metrics: map[string]int64{
+				"timer_rego_query_eval_ns": log.Latency.Nanoseconds(),
+			},
+		}
+		// A query of a rule is logged as a path like Data API, and other queries are logged as ad-hoc queries.
+		if path, ok := strings.CutPrefix(log.Query, "data."); ok && !strings.ContainsAny(path, " :=[]();") {
+			event.Path = strings.ReplaceAll(path, ".", "/")
+		} else {
+			event.Query = log.Query
+		}
+		events = append(events, event)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(events); err != nil {
+		return fmt.Errorf("failed to encode decision logs: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress decision logs: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to create request of decision logs: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send decision logs: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code from decision log service: %d msg='%s'", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// sourceType returns the type name of the source recorded in decision logs.
+func sourceType(src Source) string {
+	switch s := src.(type) {
+	case *fileSource:
+		return "files"
+	case *dataSource:
+		return "data"
+	case *fsSource:
+		return "fs"
+	case *bundleSource:
+		if s.url != "" {
+			return "bundle_server"
+		}
+		return "bundle"
+	case *remoteSource:
+		return "remote"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,225 @@
+package opac_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+const decisionPolicy = `package authz
+
+allow := input.user == "alice"
+`
+
+type memorySink struct {
+	mutex sync.Mutex
+	logs  []*opac.DecisionLog
+	err   error
+	block chan struct{}
+}
+
+func (s *memorySink) Write(ctx context.Context, logs []*opac.DecisionLog) error {
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.logs = append(s.logs, logs...)
+	return nil
+}
+
+func TestDecisionLogger(t *testing.T) {
+	sink := &memorySink{}
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithDecisionLogger(sink),
+		opac.WithMask("/input/password", "/input/missing"),
+	)).NoError(t)
+
+	ctx := context.Background()
+	input := map[string]any{"user": "alice", "password": "secret"}
+	var output struct {
+		Allow bool `json:"allow"`
+	}
+	gt.NoError(t, client.Query(ctx, "data.authz", input, &output))
+	gt.Error(t, client.Query(ctx, "data.unknown", input, &output))
+	gt.R1(client.QueryResultSet(ctx, "x := data.authz.allow", input)).NoError(t)
+	gt.NoError(t, client.Close())
+
+	// The input of the caller must not be modified by masking
+	gt.Equal(t, input["password"], any("secret"))
+
+	gt.A(t, sink.logs).Length(3)
+	log := sink.logs[0]
+	gt.Equal(t, log.Query, "data.authz")
+	gt.Equal(t, log.Input, any(map[string]any{"user": "alice"}))
+	gt.Equal(t, log.Result, any(map[string]any{"allow": true}))
+	gt.Equal(t, log.Source, "data")
+	gt.Equal(t, log.Path, opac.PathEvaluated)
+	gt.Equal(t, log.Erased, []string{"/input/password"})
+	gt.Equal(t, log.Error, "")
+	gt.True(t, log.DecisionID != "")
+	gt.True(t, log.Latency > 0)
+
+	gt.Equal(t, sink.logs[1].Result, nil)
+	gt.True(t, strings.Contains(sink.logs[1].Error, opac.ErrNoEvalResult.Error()))
+	gt.True(t, sink.logs[0].DecisionID != sink.logs[1].DecisionID)
+	gt.Equal(t, sink.logs[2].Query, "x := data.authz.allow")
+
+	gt.Equal(t, client.DecisionLogStats(), opac.DecisionLogStats{Written: 3})
+}
+
+func TestDecisionLoggerFallback(t *testing.T) {
+	sink := &memorySink{}
+	unavailable := opac.Remote("http://localhost", opac.WithHTTPClient(&httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		},
+	}))
+	fallback := opac.BundleReader(bytes.NewReader(writeBundle(t, newTestBundle("v2"))))
+	client := gt.R1(opac.New(unavailable,
+		opac.WithFailurePolicy(opac.Fallback(fallback)),
+		opac.WithDecisionLogger(sink),
+	)).NoError(t)
+
+	var allow bool
+	gt.NoError(t, client.Query(context.Background(), "data.authz.allow", map[string]any{"user": "alice"}, &allow))
+	gt.True(t, allow)
+	gt.NoError(t, client.Close())
+
+	// The log has the source that decided the result
+	gt.A(t, sink.logs).Length(1)
+	gt.Equal(t, sink.logs[0].Path, opac.PathFallback)
+	gt.Equal(t, sink.logs[0].Source, "bundle")
+	gt.Equal(t, sink.logs[0].Revision, "v2")
+}
+
+func TestDecisionLoggerDrop(t *testing.T) {
+	sink := &memorySink{block: make(chan struct{})}
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithDecisionLogger(sink, opac.WithDecisionLogBufferSize(1), opac.WithDecisionLogBatchSize(1)),
+	)).NoError(t)
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		var allow bool
+		gt.NoError(t, client.Query(ctx, "data.authz.allow", map[string]any{"user": "bob"}, &allow))
+	}
+	close(sink.block)
+	gt.NoError(t, client.Close())
+
+	stats := client.DecisionLogStats()
+	gt.True(t, stats.Dropped > 0)
+	gt.Equal(t, stats.Written+stats.Dropped, 10)
+	gt.Equal(t, uint64(len(sink.logs)), stats.Written)
+
+	// Logs after Close are dropped
+	var allow bool
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", map[string]any{"user": "bob"}, &allow))
+	gt.Equal(t, client.DecisionLogStats().Dropped, stats.Dropped+1)
+}
+
+func TestDecisionLoggerFailure(t *testing.T) {
+	sink := &memorySink{err: errors.New("unavailable")}
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithDecisionLogger(sink),
+	)).NoError(t)
+
+	var allow bool
+	gt.NoError(t, client.Query(context.Background(), "data.authz.allow", map[string]any{"user": "bob"}, &allow))
+	gt.NoError(t, client.Close())
+	gt.Equal(t, client.DecisionLogStats(), opac.DecisionLogStats{Failed: 1})
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithDecisionLogger(opac.JSONLinesSink(&buf)),
+	)).NoError(t)
+
+	ctx := context.Background()
+	for _, user := range []string{"alice", "bob"} {
+		var allow bool
+		gt.NoError(t, client.Query(ctx, "data.authz.allow", map[string]any{"user": user}, &allow))
+	}
+	gt.NoError(t, client.Close())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	gt.A(t, lines).Length(2)
+	var log map[string]any
+	gt.NoError(t, json.Unmarshal([]byte(lines[1]), &log))
+	gt.Equal(t, log["query"], any("data.authz.allow"))
+	gt.Equal(t, log["result"], any(false))
+	gt.Equal(t, log["input"], any(map[string]any{"user": "bob"}))
+}
+
+func TestHTTPSink(t *testing.T) {
+	type event struct {
+		Labels     map[string]string `json:"labels"`
+		DecisionID string            `json:"decision_id"`
+		Path       string            `json:"path"`
+		Query      string            `json:"query"`
+		Result     any               `json:"result"`
+		Metrics    map[string]int64  `json:"metrics"`
+	}
+
+	var events []event
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			gt.Equal(t, req.Method, http.MethodPost)
+			gt.Equal(t, req.URL.String(), "https://example.com/logs")
+			gt.Equal(t, req.Header.Get("Content-Encoding"), "gzip")
+
+			gz := gt.R1(gzip.NewReader(req.Body)).NoError(t)
+			var received []event
+			gt.NoError(t, json.NewDecoder(gz).Decode(&received))
+			events = append(events, received...)
+
+			return &http.Response{
+				StatusCode: http.StatusNoContent,
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		},
+	}
+
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithDecisionLogger(opac.HTTPSink("https://example.com/logs",
+			opac.WithSinkHTTPClient(mock),
+			opac.WithSinkLabels(map[string]string{"app": "test"}),
+		)),
+	)).NoError(t)
+
+	ctx := context.Background()
+	var allow bool
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", map[string]any{"user": "alice"}, &allow))
+	gt.R1(client.QueryResultSet(ctx, "x := data.authz.allow", nil)).NoError(t)
+	gt.NoError(t, client.Close())
+
+	gt.A(t, events).Length(2)
+	gt.Equal(t, events[0].Path, "authz/allow")
+	gt.Equal(t, events[0].Query, "")
+	gt.Equal(t, events[0].Result, any(true))
+	gt.Equal(t, events[0].Labels, map[string]string{"app": "test"})
+	gt.True(t, events[0].Metrics["timer_rego_query_eval_ns"] > 0)
+	gt.Equal(t, events[1].Path, "")
+	gt.Equal(t, events[1].Query, "x := data.authz.allow")
+	gt.Equal(t, client.DecisionLogStats().Written, 2)
+}
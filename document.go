@@ -0,0 +1,103 @@
+package opac
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/storage"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+	"github.com/open-policy-agent/opa/v1/util"
+)
+
+// isDataFile returns true if the file name is a base document file (data.json or data.yaml) loaded in the same manner as OPA bundles.
+func isDataFile(name string) bool {
+	switch path.Base(name) {
+	case "data.json", "data.yaml":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseDocument parses JSON or YAML base document.
+func parseDocument(raw []byte) (any, error) {
+	var doc any
+	if err := util.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// dataPath converts a slash separated directory path into the path of base document. Empty and "." segments are ignored.
+func dataPath(dir string) []string {
+	var keys []string
+	for _, key := range strings.Split(dir, "/") {
+		if key == "" || key == "." {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// mergeDocument puts the value at the path in the root document. Objects are merged recursively, and it returns an error if a non-object value conflicts with an existing value.
+func mergeDocument(root map[string]any, keys []string, value any) error {
+	if len(keys) == 0 {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("base document at root must be an object")
+		}
+		for k, v := range obj {
+			if err := mergeDocument(root, []string{k}, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	node := root
+	for i, key := range keys[:len(keys)-1] {
+		next, ok := node[key]
+		if !ok {
+			child := map[string]any{}
+			node[key] = child
+			node = child
+			continue
+		}
+
+		child, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("conflicting base document at data.%s", strings.Join(keys[:i+1], "."))
+		}
+		node = child
+	}
+
+	last := keys[len(keys)-1]
+	current, exists := node[last]
+	if !exists {
+		node[last] = value
+		return nil
+	}
+
+	_, isObj := current.(map[string]any)
+	src, ok := value.(map[string]any)
+	if !isObj || !ok {
+		return fmt.Errorf("conflicting base document at data.%s", strings.Join(keys, "."))
+	}
+	for k, v := range src {
+		if err := mergeDocument(root, append(keys[:len(keys):len(keys)], k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newStore creates in-memory store having the base documents.
+func newStore(documents map[string]any) storage.Store {
+	if documents == nil {
+		documents = map[string]any{}
+	}
+	return inmem.NewFromObject(documents)
+}
@@ -1,6 +1,14 @@
 package opac
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/topdown"
+)
 
 var (
 	// ErrNoPolicyData is returned when no policy data is provided.
@@ -8,4 +16,295 @@ var (
 
 	// ErrNoPolicySrc is returned when no result of evaluation is provided. If you expect a result, you should check the error. If you don't expect a result, you should ignore the error.
 	ErrNoEvalResult = errors.New("no evaluation result")
+
+	// ErrMissingBundleSignature is returned with BundleVerificationError when verification keys are set but the bundle has no .signatures.json file.
+	ErrMissingBundleSignature = errors.New("bundle signature is missing")
+
+	// ErrCircuitOpen is returned without sending a request when the circuit breaker for OPA server is open.
+	ErrCircuitOpen = errors.New("circuit breaker for OPA server is open")
+
+	// ErrQueryTimeout is wrapped by LimitError when a query exceeds the timeout set by WithQueryTimeout.
+	ErrQueryTimeout = errors.New("query timed out")
+
+	// ErrMaxEvalSteps is wrapped by LimitError when evaluation exceeds the steps set by WithMaxEvalSteps.
+	ErrMaxEvalSteps = errors.New("evaluation exceeded maximum steps")
+
+	// ErrMaxInputSize is wrapped by LimitError when an input exceeds the size set by WithMaxInputSize.
+	ErrMaxInputSize = errors.New("input exceeded maximum size")
+
+	// ErrMaxOutputSize is wrapped by LimitError when a result exceeds the size set by WithMaxOutputSize.
+	ErrMaxOutputSize = errors.New("result exceeded maximum size")
+
+	// ErrFallbackNotConfigured is returned when a Fallback policy of WithQueryFailurePolicy uses a source that is not configured by the client. Set the source with WithQueryFallbacks.
+	ErrFallbackNotConfigured = errors.New("fallback source is not configured by the client")
 )
+
+// BundleVerificationError is returned when the signature of a bundle is missing, invalid or does not cover every file in the bundle.
+type BundleVerificationError struct {
+	Err error
+}
+
+func (e *BundleVerificationError) Error() string {
+	return "failed to verify bundle: " + e.Err.Error()
+}
+
+func (e *BundleVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// FailClosedError is returned by the FailClosed failure policy when evaluation of a query fails or returns no result. The original error is available with errors.Unwrap.
+type FailClosedError struct {
+	Err error
+}
+
+func (e *FailClosedError) Error() string {
+	return "query failed closed: " + e.Err.Error()
+}
+
+func (e *FailClosedError) Unwrap() error {
+	return e.Err
+}
+
+// LimitError is returned when a query exceeds a limit of the client. Err is one of ErrQueryTimeout, ErrMaxEvalSteps, ErrMaxInputSize and ErrMaxOutputSize, so the exceeded limit can be checked with errors.Is. A LimitError is caused by the query or the policy rather than by infrastructure such as OPA server.
+type LimitError struct {
+	// Err is the sentinel error of the exceeded limit.
+	Err error
+
+	// Limit is the value of the limit: nanoseconds for ErrQueryTimeout, steps for ErrMaxEvalSteps and bytes for the others.
+	Limit int64
+
+	// Cause is the original error, such as an error of context cancellation. It can be nil.
+	Cause error
+}
+
+func (e *LimitError) Error() string {
+	limit := fmt.Sprintf("%d", e.Limit)
+	if errors.Is(e.Err, ErrQueryTimeout) {
+		limit = time.Duration(e.Limit).String()
+	}
+
+	msg := fmt.Sprintf("%s (limit: %s)", e.Err.Error(), limit)
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+func (e *LimitError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// Location is a position in a Rego file.
+type Location struct {
+	File string `json:"file"`
+	Row  int    `json:"row"`
+	Col  int    `json:"col"`
+}
+
+// RegoError is an error reported by the Rego compiler.
+type RegoError struct {
+	// Code is the error code of OPA, such as rego_parse_error and rego_type_error.
+	Code string `json:"code"`
+
+	// Message is the message of the error without the location.
+	Message string `json:"message"`
+
+	// Location is the position of the error. It is nil if the position is unknown.
+	Location *Location `json:"location,omitempty"`
+}
+
+// String returns the error with its location, such as "policy.rego:3: rego_compile_error: declared var x unused".
+func (e *RegoError) String() string {
+	if e.Location == nil {
+		return e.Code + ": " + e.Message
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", e.Location.File, e.Location.Row, e.Code, e.Message)
+}
+
+// CompileError is returned when policies or a query can not be parsed or compiled. Errors has all errors reported by the compiler with their positions.
+type CompileError struct {
+	Errors []*RegoError
+	Err    error
+}
+
+func (e *CompileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// newCompileError creates CompileError wrapping err with the message. Errors are extracted from ast.Errors in err.
+func newCompileError(msg string, err error) error {
+	compileErr := &CompileError{
+		Err: fmt.Errorf("%s: %w", msg, err),
+	}
+
+	var astErrs ast.Errors
+	if errors.As(err, &astErrs) {
+		compileErr.Errors = newRegoErrors(astErrs)
+	}
+	return compileErr
+}
+
+func newRegoErrors(astErrs ast.Errors) []*RegoError {
+	var errs []*RegoError
+	for _, astErr := range astErrs {
+		errs = append(errs, &RegoError{
+			Code:     astErr.Code,
+			Message:  astErr.Message,
+			Location: newLocation(astErr.Location),
+		})
+	}
+	return errs
+}
+
+// EvalError is returned when evaluation of a query fails at runtime, such as a conflict of rule values or an error of a builtin function.
+type EvalError struct {
+	// Code is the error code of OPA, such as eval_conflict_error and eval_builtin_error. It is empty if the error is not reported by OPA evaluator.
+	Code string
+
+	// Message is the message of the error without the location.
+	Message string
+
+	// Location is the position of the error. It is nil if the position is unknown.
+	Location *Location
+
+	Err error
+}
+
+func (e *EvalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// newEvalError creates EvalError wrapping err. The code and location are extracted from topdown.Error in err.
+func newEvalError(err error) error {
+	evalErr := &EvalError{
+		Message: err.Error(),
+		Err:     fmt.Errorf("failed to evaluate query: %w", err),
+	}
+
+	var topdownErr *topdown.Error
+	if errors.As(err, &topdownErr) {
+		evalErr.Code = topdownErr.Code
+		evalErr.Message = topdownErr.Message
+		evalErr.Location = newLocation(topdownErr.Location)
+	}
+	return evalErr
+}
+
+func newLocation(loc *ast.Location) *Location {
+	if loc == nil {
+		return nil
+	}
+	return &Location{
+		File: loc.File,
+		Row:  loc.Row,
+		Col:  loc.Col,
+	}
+}
+
+// RemoteError is returned when a request to OPA server fails. StatusCode is zero if no response was received, such as a network error or the open circuit breaker.
+type RemoteError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Code is the error code in the response body of OPA server, such as invalid_parameter and internal_error.
+	Code string
+
+	// Message is the error message in the response body of OPA server.
+	Message string
+
+	// Body is the raw response body. It is not included in the error message because it may contain input values.
+	Body []byte
+
+	// Err is the error of the request if no response was received.
+	Err error
+}
+
+func (e *RemoteError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("unexpected status code from OPA server: %d code=%s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("unexpected status code from OPA server: %d", e.StatusCode)
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
+
+// newRemoteStatusError creates RemoteError from the response of unexpected status code. The error code and message are read from the body in the format of OPA server.
+func newRemoteStatusError(status int, body []byte) *RemoteError {
+	remoteErr := &RemoteError{
+		StatusCode: status,
+		Body:       body,
+	}
+
+	var resp struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil {
+		remoteErr.Code = resp.Code
+		remoteErr.Message = resp.Message
+	}
+	return remoteErr
+}
+
+// newRemoteError wraps err with RemoteError unless it is already RemoteError. It returns nil for nil error.
+func newRemoteError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var remoteErr *RemoteError
+	if errors.As(err, &remoteErr) {
+		return err
+	}
+	return &RemoteError{Err: err}
+}
+
+// DecodeError is returned when a result can not be decoded into the output, such as a type mismatch between the result and the output.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// newDecodeError wraps err with DecodeError. It returns nil for nil error.
+func newDecodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DecodeError{Err: err}
+}
+
+// SQLTranslationError is returned when a residual query can not be translated into SQL.
+type SQLTranslationError struct {
+	// Expr is the expression that can not be translated.
+	Expr string
+
+	// Reason is the reason why the expression can not be translated.
+	Reason string
+}
+
+func (e *SQLTranslationError) Error() string {
+	return fmt.Sprintf("failed to translate residual into SQL: %s: %s", e.Reason, e.Expr)
+}
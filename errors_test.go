@@ -0,0 +1,156 @@
+package opac_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+func TestCompileError(t *testing.T) {
+	t.Run("policy", func(t *testing.T) {
+		_, err := opac.New(opac.Data(map[string]string{
+			"policy.rego": "package authz\n\nallow := unknown_func(input)\n",
+		}))
+
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+		gt.A(t, compileErr.Errors).Length(1)
+		gt.Equal(t, compileErr.Errors[0].Code, "rego_type_error")
+		gt.Equal(t, *compileErr.Errors[0].Location, opac.Location{File: "policy.rego", Row: 3, Col: 10})
+	})
+
+	t.Run("parse error in files", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir+"/policy.rego", "package authz\n\nallow := {\n")
+		_, err := opac.New(opac.Files(dir))
+
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+		gt.A(t, compileErr.Errors).Longer(0)
+		gt.Equal(t, compileErr.Errors[0].Code, "rego_parse_error")
+		gt.True(t, strings.HasSuffix(compileErr.Errors[0].Location.File, "policy.rego"))
+	})
+
+	t.Run("parse error in bundle", func(t *testing.T) {
+		files := newTestBundle("v1")
+		files["authz/policy.rego"] = "package authz\n\nallow if {\n"
+		_, err := opac.New(opac.BundleReader(bytes.NewReader(writeBundle(t, files))))
+
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+		gt.A(t, compileErr.Errors).Longer(0)
+		gt.Equal(t, compileErr.Errors[0].Code, "rego_parse_error")
+		gt.True(t, strings.HasSuffix(compileErr.Errors[0].Location.File, "authz/policy.rego"))
+	})
+
+	t.Run("query", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": decisionPolicy}))).NoError(t)
+		var out any
+		err := client.Query(context.Background(), "data.authz.allow[", nil, &out)
+
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+		gt.Equal(t, compileErr.Errors[0].Code, "rego_parse_error")
+	})
+}
+
+func TestEvalError(t *testing.T) {
+	policy := `package authz
+
+allow := true if { input.user == "alice" }
+allow := false if { input.user == "alice" }
+`
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}))).NoError(t)
+
+	var out any
+	err := client.Query(context.Background(), "data.authz.allow", map[string]any{"user": "alice"}, &out)
+
+	var evalErr *opac.EvalError
+	gt.True(t, errors.As(err, &evalErr))
+	gt.Equal(t, evalErr.Code, "eval_conflict_error")
+	gt.Equal(t, evalErr.Location.File, "policy.rego")
+	gt.True(t, evalErr.Location.Row > 0)
+}
+
+func TestRemoteError(t *testing.T) {
+	t.Run("status code", func(t *testing.T) {
+		mock := &httpMock{
+			do: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Body:       io.NopCloser(strings.NewReader(`{"code": "invalid_parameter", "message": "error(s) occurred while compiling module(s)", "input": {"token": "secret"}}`)),
+				}, nil
+			},
+		}
+		client := gt.R1(opac.New(opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)))).NoError(t)
+
+		var out any
+		err := client.Query(context.Background(), "data.authz", nil, &out)
+
+		var remoteErr *opac.RemoteError
+		gt.True(t, errors.As(err, &remoteErr))
+		gt.Equal(t, remoteErr.StatusCode, http.StatusBadRequest)
+		gt.Equal(t, remoteErr.Code, "invalid_parameter")
+		gt.Equal(t, remoteErr.Message, "error(s) occurred while compiling module(s)")
+		gt.True(t, strings.Contains(string(remoteErr.Body), "invalid_parameter"))
+
+		// The raw body is kept only in the field
+		gt.Equal(t, remoteErr.Error(), "unexpected status code from OPA server: 400 code=invalid_parameter")
+		gt.False(t, strings.Contains(err.Error(), "secret"))
+	})
+
+	t.Run("network error", func(t *testing.T) {
+		mock := &httpMock{
+			do: func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+		}
+		client := gt.R1(opac.New(opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)))).NoError(t)
+
+		_, err := client.QueryResultSet(context.Background(), "x := data.authz", nil)
+
+		var remoteErr *opac.RemoteError
+		gt.True(t, errors.As(err, &remoteErr))
+		gt.Equal(t, remoteErr.StatusCode, 0)
+		gt.Error(t, remoteErr.Err)
+	})
+}
+
+func TestDecodeError(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": decisionPolicy}))).NoError(t)
+
+		var out struct {
+			Allow string `json:"allow"`
+		}
+		err := client.Query(context.Background(), "data.authz", map[string]any{"user": "alice"}, &out)
+
+		var decodeErr *opac.DecodeError
+		gt.True(t, errors.As(err, &decodeErr))
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		mock := &httpMock{
+			do: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(`not json`)),
+				}, nil
+			},
+		}
+		client := gt.R1(opac.New(opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)))).NoError(t)
+
+		var out any
+		err := client.Query(context.Background(), "data.authz", nil, &out)
+
+		var decodeErr *opac.DecodeError
+		gt.True(t, errors.As(err, &decodeErr))
+	})
+}
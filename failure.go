@@ -0,0 +1,193 @@
+package opac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecisionPath describes how the result of a query is decided.
+type DecisionPath string
+
+const (
+	// PathEvaluated means the result is evaluated by the source, or the query failed without failure policy.
+	PathEvaluated DecisionPath = "evaluated"
+
+	// PathDefault means the evaluation failed and the default output of the failure policy is returned.
+	PathDefault DecisionPath = "default"
+
+	// PathFailClosed means the evaluation failed and FailClosedError is returned.
+	PathFailClosed DecisionPath = "fail_closed"
+
+	// PathFallback means the evaluation failed and the result is evaluated by the fallback source.
+	PathFallback DecisionPath = "fallback"
+)
+
+type failureMode int
+
+const (
+	failureNone failureMode = iota
+	failureDefault
+	failureClosed
+	failureFallback
+)
+
+// FailurePolicy decides what happens when evaluation of a query fails or returns no result. It is created by DefaultOutput, FailClosed or Fallback, and set by WithFailurePolicy for the client or WithQueryFailurePolicy for a query.
+type FailurePolicy struct {
+	mode     failureMode
+	output   any
+	fallback Source
+}
+
+// DefaultOutput returns a failure policy that writes the output value to the output of Query instead of returning an error. The value is converted in the same manner as JSON encoding.
+//
+// Example:
+//
+//	// deny by default
+//	opac.WithFailurePolicy(opac.DefaultOutput(map[string]any{"allow": false}))
+func DefaultOutput(output any) FailurePolicy {
+	return FailurePolicy{
+		mode:   failureDefault,
+		output: output,
+	}
+}
+
+// FailClosed returns a failure policy that returns *FailClosedError wrapping the original error, so that callers can deny the request with errors.As regardless of the cause.
+func FailClosed() FailurePolicy {
+	return FailurePolicy{
+		mode: failureClosed,
+	}
+}
+
+// Fallback returns a failure policy that evaluates the query with the secondary source. The source is configured with the same options of the client when the client is created, and closed by Client.Close so that its background tasks such as watching files are stopped. A policy shared between clients is configured and closed by each client, but the source keeps the policies of the client configured last, so use a separate source for clients with different options.
+//
+// A policy set by WithFailurePolicy configures its source automatically. A policy set by WithQueryFailurePolicy can use only a source configured by the client, which is the source of WithFailurePolicy or one of WithQueryFallbacks. Otherwise the query returns an error wrapping ErrFallbackNotConfigured.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Remote(opaServerURL),
+//		opac.WithFailurePolicy(opac.Fallback(opac.Bundle("fallback.tar.gz"))),
+//	)
+func Fallback(src Source) FailurePolicy {
+	return FailurePolicy{
+		mode:     failureFallback,
+		fallback: src,
+	}
+}
+
+// WithFailurePolicy sets the failure policy for all queries of the client.
+func WithFailurePolicy(policy FailurePolicy) Option {
+	return func(cfg *config) {
+		cfg.failurePolicy = policy
+	}
+}
+
+// WithQueryFailurePolicy sets the failure policy for the query. It overrides the policy of the client.
+func WithQueryFailurePolicy(policy FailurePolicy) QueryOption {
+	return func(o *queryOptions) {
+		o.failurePolicy = &policy
+	}
+}
+
+// WithQueryFallbacks sets secondary sources used by Fallback policies of WithQueryFailurePolicy. The sources are configured once when the client is created and closed by Client.Close, so that a per-query policy does not configure a new source for each query.
+//
+// Example:
+//
+//	secondary := opac.Bundle("fallback.tar.gz")
+//	client, err := opac.New(opac.Remote(opaServerURL), opac.WithQueryFallbacks(secondary))
+//	// ...
+//	err = client.Query(ctx, "data.authz", input, &output, opac.WithQueryFailurePolicy(opac.Fallback(secondary)))
+func WithQueryFallbacks(sources ...Source) Option {
+	return func(cfg *config) {
+		cfg.queryFallbacks = append(cfg.queryFallbacks, sources...)
+	}
+}
+
+// WithDecisionPath sets a pointer to receive how the result of the query is decided. It can be used for logging and metrics of failures.
+func WithDecisionPath(path *DecisionPath) QueryOption {
+	return func(o *queryOptions) {
+		o.decisionPath = path
+	}
+}
+
+// fallbackSources keeps secondary sources configured by a client. Each source is configured once per client and closed in Client.Close.
+type fallbackSources struct {
+	sources    []Source
+	configured map[Source]struct{}
+}
+
+// configureFallbacks configures the fallback source of the client failure policy and the sources of WithQueryFallbacks. A source given more than once is configured only once. If any source fails, the sources configured so far are closed.
+func configureFallbacks(cfg *config) (*fallbackSources, error) {
+	fallbacks := &fallbackSources{
+		configured: make(map[Source]struct{}),
+	}
+
+	sources := cfg.queryFallbacks
+	if src := cfg.failurePolicy.fallback; src != nil {
+		sources = append([]Source{src}, sources...)
+	}
+
+	for _, src := range sources {
+		if fallbacks.has(src) {
+			continue
+		}
+		if err := src.Configure(cfg); err != nil {
+			_ = fallbacks.close()
+			return nil, fmt.Errorf("failed to configure fallback source: %w", err)
+		}
+		fallbacks.sources = append(fallbacks.sources, src)
+		fallbacks.configured[src] = struct{}{}
+	}
+
+	return fallbacks, nil
+}
+
+// has returns true if the source is configured by the client.
+func (s *fallbackSources) has(src Source) bool {
+	_, ok := s.configured[src]
+	return ok
+}
+
+// close closes all configured sources.
+func (s *fallbackSources) close() error {
+	var errs []error
+	for _, src := range s.sources {
+		errs = append(errs, closeSource(src))
+	}
+	return errors.Join(errs...)
+}
+
+// closeSource closes the source if it has background tasks.
+func closeSource(src Source) error {
+	if closer, ok := src.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// apply decides the result of the failed query by the policy. It returns the original error if no policy is set.
+func (p FailurePolicy) apply(ctx context.Context, cfg *config, sources *fallbackSources, query string, input, output any, opt queryOptions, queryErr error) (DecisionPath, error) {
+	switch p.mode {
+	case failureDefault:
+		cfg.logger.Warn("Query failed, returning default output", "query", query, "error", queryErr)
+		if err := decodeResult(p.output, output); err != nil {
+			return PathDefault, fmt.Errorf("failed to set default output: %w", err)
+		}
+		return PathDefault, nil
+
+	case failureClosed:
+		cfg.logger.Warn("Query failed, failing closed", "query", query, "error", queryErr)
+		return PathFailClosed, &FailClosedError{Err: queryErr}
+
+	case failureFallback:
+		cfg.logger.Warn("Query failed, falling back to secondary source", "query", query, "error", queryErr)
+		if !sources.has(p.fallback) {
+			return PathFallback, fmt.Errorf("%w: %s", ErrFallbackNotConfigured, sourceType(p.fallback))
+		}
+		return PathFallback, p.fallback.Query(ctx, query, input, output, opt)
+
+	default:
+		return PathEvaluated, queryErr
+	}
+}
@@ -0,0 +1,223 @@
+package opac_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	policy := `package authz
+
+allow := input.user == "alice"
+`
+	fallbackPolicy := `package authz
+
+allow := true
+`
+	type output struct {
+		Allow bool `json:"allow"`
+	}
+
+	type testCase struct {
+		src       opac.Source
+		options   []opac.Option
+		queryOpts []opac.QueryOption
+		query     string
+		expect    output
+		path      opac.DecisionPath
+		isErr     bool
+		failClose bool
+	}
+
+	unavailable := opac.Remote("http://localhost", opac.WithHTTPClient(&httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		},
+	}))
+
+	secondary := opac.Data(map[string]string{"policy.rego": fallbackPolicy})
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			client := gt.R1(opac.New(tc.src, tc.options...)).NoError(t)
+			t.Cleanup(func() { gt.NoError(t, client.Close()) })
+
+			var out output
+			var path opac.DecisionPath
+			opts := append(tc.queryOpts, opac.WithDecisionPath(&path))
+			err := client.Query(context.Background(), tc.query, map[string]any{"user": "bob"}, &out, opts...)
+			gt.Equal(t, path, tc.path)
+			if tc.isErr {
+				gt.Error(t, err)
+				var failClosed *opac.FailClosedError
+				gt.Equal(t, errors.As(err, &failClosed), tc.failClose)
+				return
+			}
+			gt.NoError(t, err)
+			gt.Equal(t, out, tc.expect)
+		}
+	}
+
+	t.Run("evaluated", doTest(testCase{
+		src:     opac.Data(map[string]string{"policy.rego": policy}),
+		options: []opac.Option{opac.WithFailurePolicy(opac.FailClosed())},
+		query:   "data.authz",
+		expect:  output{Allow: false},
+		path:    opac.PathEvaluated,
+	}))
+
+	t.Run("no failure policy", doTest(testCase{
+		src:   opac.Data(map[string]string{"policy.rego": policy}),
+		query: "data.unknown",
+		path:  opac.PathEvaluated,
+		isErr: true,
+	}))
+
+	t.Run("default output for no result", doTest(testCase{
+		src:     opac.Data(map[string]string{"policy.rego": policy}),
+		options: []opac.Option{opac.WithFailurePolicy(opac.DefaultOutput(map[string]any{"allow": true}))},
+		query:   "data.unknown",
+		expect:  output{Allow: true},
+		path:    opac.PathDefault,
+	}))
+
+	t.Run("fail closed for remote error", doTest(testCase{
+		src:       unavailable,
+		options:   []opac.Option{opac.WithFailurePolicy(opac.FailClosed())},
+		query:     "data.authz",
+		path:      opac.PathFailClosed,
+		isErr:     true,
+		failClose: true,
+	}))
+
+	t.Run("fallback source", doTest(testCase{
+		src:     unavailable,
+		options: []opac.Option{opac.WithFailurePolicy(opac.Fallback(opac.Data(map[string]string{"policy.rego": fallbackPolicy})))},
+		query:   "data.authz",
+		expect:  output{Allow: true},
+		path:    opac.PathFallback,
+	}))
+
+	t.Run("query policy overrides client policy", doTest(testCase{
+		src:       opac.Data(map[string]string{"policy.rego": policy}),
+		options:   []opac.Option{opac.WithFailurePolicy(opac.FailClosed()), opac.WithQueryFallbacks(secondary)},
+		queryOpts: []opac.QueryOption{opac.WithQueryFailurePolicy(opac.Fallback(secondary))},
+		query:     "data.authz.unknown",
+		path:      opac.PathFallback,
+		isErr:     true,
+	}))
+}
+
+func TestFallbackConfigureError(t *testing.T) {
+	_, err := opac.New(
+		opac.Data(map[string]string{"policy.rego": "package authz\n"}),
+		opac.WithFailurePolicy(opac.Fallback(opac.Files("testdata/not_found"))),
+	)
+	gt.Error(t, err)
+}
+
+// closeCounter wraps a source to count calls of Close.
+type closeCounter struct {
+	opac.Source
+	closed atomic.Int32
+}
+
+func (c *closeCounter) Close() error {
+	c.closed.Add(1)
+	if closer, ok := c.Source.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// countSpans returns the number of recorded spans with the name. Each configuration of a local source records an opac.Compile span.
+func countSpans(recorder *tracetest.SpanRecorder, name string) int {
+	var n int
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFallbackClose(t *testing.T) {
+	unavailable := opac.Remote("http://localhost", opac.WithHTTPClient(&httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		},
+	}))
+	fallback := &closeCounter{Source: opac.Data(map[string]string{"policy.rego": "package authz\n\nallow := true\n"})}
+
+	recorder, provider := newSpanRecorder()
+	client := gt.R1(opac.New(unavailable,
+		opac.WithTracerProvider(provider),
+		opac.WithFailurePolicy(opac.Fallback(fallback)),
+		opac.WithQueryFallbacks(fallback),
+	)).NoError(t)
+
+	ctx := context.Background()
+	for i := 0; i < 50; i++ {
+		// A query failure policy built for each query reuses the source configured by the client
+		var allow bool
+		gt.NoError(t, client.Query(ctx, "data.authz.allow", nil, &allow, opac.WithQueryFailurePolicy(opac.Fallback(fallback))))
+		gt.True(t, allow)
+	}
+	gt.Equal(t, countSpans(recorder, "opac.Compile"), 1)
+
+	// A source not configured by the client is rejected without being configured
+	var allow bool
+	other := opac.Data(map[string]string{"policy.rego": "package authz\n\nallow := true\n"})
+	err := client.Query(ctx, "data.authz.allow", nil, &allow, opac.WithQueryFailurePolicy(opac.Fallback(other)))
+	gt.True(t, errors.Is(err, opac.ErrFallbackNotConfigured))
+	gt.Equal(t, countSpans(recorder, "opac.Compile"), 1)
+
+	gt.Equal(t, fallback.closed.Load(), 0)
+	gt.NoError(t, client.Close())
+	gt.Equal(t, fallback.closed.Load(), 1)
+}
+
+func TestFallbackSharedPolicy(t *testing.T) {
+	unavailable := func() opac.Source {
+		return opac.Remote("http://localhost", opac.WithHTTPClient(&httpMock{
+			do: func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+		}))
+	}
+	fallback := &closeCounter{Source: opac.Data(map[string]string{"policy.rego": "package authz\n\nallow := true\n"})}
+	policy := opac.Fallback(fallback)
+
+	// Each client configures and closes the source of the shared policy by itself
+	var recorders []*tracetest.SpanRecorder
+	var clients []*opac.Client
+	for i := 0; i < 2; i++ {
+		recorder, provider := newSpanRecorder()
+		client := gt.R1(opac.New(unavailable(),
+			opac.WithTracerProvider(provider),
+			opac.WithFailurePolicy(policy),
+		)).NoError(t)
+		recorders = append(recorders, recorder)
+		clients = append(clients, client)
+	}
+
+	for i, client := range clients {
+		var allow bool
+		gt.NoError(t, client.Query(context.Background(), "data.authz.allow", nil, &allow))
+		gt.True(t, allow)
+		gt.Equal(t, countSpans(recorders[i], "opac.Compile"), 1)
+	}
+
+	gt.NoError(t, clients[0].Close())
+	gt.Equal(t, fallback.closed.Load(), 1)
+	gt.NoError(t, clients[1].Close())
+	gt.Equal(t, fallback.closed.Load(), 2)
+}
@@ -0,0 +1,82 @@
+package opac
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+type fsSource struct {
+	localEngine
+	fsys  fs.FS
+	roots []string
+}
+
+// FS is an option to read rego files and base documents from fs.FS, such as embed.FS. Files are discovered with the same rules as Files: roots are walked recursively, .rego files are loaded as policies, and data.json and data.yaml files are loaded as base documents placed under the directory path relative to the root. The roots must be valid paths for fs.FS (slash separated, unrooted). If no root is given, the whole file system is read.
+//
+// Example:
+//
+//	//go:embed policy
+//	var policyFS embed.FS
+//
+//	client, err := opac.New(opac.FS(policyFS, "policy"))
+func FS(fsys fs.FS, roots ...string) Source {
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	return &fsSource{
+		fsys:  fsys,
+		roots: roots,
+	}
+}
+
+// Configure implements Source.
+func (f *fsSource) Configure(cfg *config) error {
+	return f.configurePolicies(cfg, func() (*policySet, error) { return f.load(cfg) })
+}
+
+func (f *fsSource) load(cfg *config) (*policySet, error) {
+	files := newPolicyFiles()
+	for _, root := range f.roots {
+		cfg.logger.Debug("Importing policy files/dirs from fs.FS", "path", root)
+		err := fs.WalkDir(f.fsys, root, func(fpath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isPolicyFile(fpath) {
+				return nil
+			}
+
+			cfg.logger.Debug("Reading policy file", "path", fpath)
+			raw, err := fs.ReadFile(f.fsys, fpath)
+			if err != nil {
+				return fmt.Errorf("failed to read policy file: %w", err)
+			}
+
+			return files.add(fpath, relativeDir(root, fpath), raw)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk directory: %w", err)
+		}
+	}
+	cfg.logger.Debug("Policy files are loaded", "file count", len(files.modules))
+
+	return files.policySet(cfg)
+}
+
+// relativeDir returns the directory of the slash separated file path relative to the root. A file given as the root itself is placed at ".".
+func relativeDir(root, fpath string) string {
+	if fpath == root {
+		return "."
+	}
+
+	dir := path.Dir(fpath)
+	if root == "." {
+		return dir
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(dir, root), "/")
+}
+
+var _ Source = (*fsSource)(nil)
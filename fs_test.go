@@ -0,0 +1,82 @@
+package opac_test
+
+import (
+	"context"
+	"embed"
+	"testing"
+	"testing/fstest"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+//go:embed testdata/documents testdata/local
+var testFS embed.FS
+
+func TestFS(t *testing.T) {
+	type testCase struct {
+		src    opac.Source
+		query  string
+		input  map[string]any
+		output map[string]any
+		newErr bool
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			client, err := opac.New(tc.src)
+			if tc.newErr {
+				gt.Error(t, err)
+				return
+			}
+			gt.NoError(t, err)
+
+			var output map[string]any
+			gt.NoError(t, client.Query(context.Background(), tc.query, tc.input, &output))
+			gt.Equal(t, tc.output, output)
+		}
+	}
+
+	memFS := fstest.MapFS{
+		"policy/color.rego":        {Data: []byte(`package color` + "\n" + `number := data.numbers[input.color]`)},
+		"policy/numbers/data.json": {Data: []byte(`{"blue": 5}`)},
+		"policy/README.md":         {Data: []byte(`# not a policy`)},
+	}
+
+	t.Run("embed.FS", doTest(testCase{
+		src:    opac.FS(testFS, "testdata/local"),
+		query:  "data.color",
+		input:  map[string]any{"color": "blue"},
+		output: map[string]any{"number": float64(5)},
+	}))
+
+	t.Run("embed.FS with data file", doTest(testCase{
+		src:    opac.FS(testFS, "testdata/documents"),
+		query:  "data.authz",
+		input:  map[string]any{"user": "alice"},
+		output: map[string]any{"allow": true},
+	}))
+
+	t.Run("in-memory FS without root", doTest(testCase{
+		src:    opac.FS(memFS),
+		query:  "data.policy.numbers",
+		output: map[string]any{"blue": float64(5)},
+	}))
+
+	t.Run("in-memory FS with root", doTest(testCase{
+		src:    opac.FS(memFS, "policy"),
+		query:  "data.color",
+		input:  map[string]any{"color": "blue"},
+		output: map[string]any{"number": float64(5)},
+	}))
+
+	t.Run("no policy file", doTest(testCase{
+		src:    opac.FS(memFS, "policy/README.md"),
+		newErr: true,
+	}))
+
+	t.Run("root not found", doTest(testCase{
+		src:    opac.FS(memFS, "not_found"),
+		newErr: true,
+	}))
+}
@@ -0,0 +1,156 @@
+package opac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/topdown"
+)
+
+// WithQueryTimeout sets the default timeout of a query. It is applied to every query of the client, and a shorter deadline of the given context is kept. The query returns *LimitError wrapping ErrQueryTimeout when the timeout is exceeded. Zero or a negative value disables the timeout.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.queryTimeout = timeout
+	}
+}
+
+// WithMaxEvalSteps sets the maximum number of evaluation steps of a query for local sources. The evaluation is canceled and *LimitError wrapping ErrMaxEvalSteps is returned when it exceeds the limit, so that an expensive policy does not pin a CPU. A step is an evaluation of an expression, a unification or a backtrack such as each element of an iteration, and a builtin call is counted as one step however long it takes. Zero or a negative value disables the limit.
+func WithMaxEvalSteps(steps int64) Option {
+	return func(cfg *config) {
+		cfg.maxEvalSteps = steps
+	}
+}
+
+// WithMaxInputSize sets the maximum size of the JSON encoded input in bytes. The query returns *LimitError wrapping ErrMaxInputSize without evaluation if the input exceeds the limit. Zero or a negative value disables the limit.
+func WithMaxInputSize(size int64) Option {
+	return func(cfg *config) {
+		cfg.maxInputSize = size
+	}
+}
+
+// WithMaxOutputSize sets the maximum size of the JSON encoded result in bytes. The query returns *LimitError wrapping ErrMaxOutputSize instead of the result if it exceeds the limit. For Remote source, the size of the response body is checked. Zero or a negative value disables the limit.
+func WithMaxOutputSize(size int64) Option {
+	return func(cfg *config) {
+		cfg.maxOutputSize = size
+	}
+}
+
+// withQueryTimeout returns the context with the default timeout of the client.
+func (c *Client) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cfg.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeoutCause(ctx, c.cfg.queryTimeout, &LimitError{
+		Err:   ErrQueryTimeout,
+		Limit: int64(c.cfg.queryTimeout),
+	})
+}
+
+// limitCause replaces the error with *LimitError if the context is canceled by a limit.
+func limitCause(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var limitErr *LimitError
+	if cause := context.Cause(ctx); errors.As(cause, &limitErr) && ctx.Err() != nil {
+		return &LimitError{
+			Err:   limitErr.Err,
+			Limit: limitErr.Limit,
+			Cause: err,
+		}
+	}
+	return err
+}
+
+// checkSize returns *LimitError if size exceeds the limit.
+func checkSize(sentinel error, limit int64, size int) error {
+	if limit > 0 && int64(size) > limit {
+		return &LimitError{
+			Err:   sentinel,
+			Limit: limit,
+			Cause: fmt.Errorf("size is %d bytes", size),
+		}
+	}
+	return nil
+}
+
+// encodedSize returns the size of the JSON encoded value.
+func encodedSize(value any) (int, error) {
+	if v, ok := value.(ast.Value); ok {
+		return len(v.String()), nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return len(raw), nil
+}
+
+// checkEncodedSize returns *LimitError if the JSON encoded value exceeds the limit. The value is encoded only if the limit is set.
+func checkEncodedSize(sentinel error, limit int64, value any) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	size, err := encodedSize(value)
+	if err != nil {
+		return err
+	}
+	return checkSize(sentinel, limit, size)
+}
+
+// stepOps are trace events that do evaluation work. Iteration over a collection emits Redo and Unify events for each element without Eval events, so that they are counted as well.
+var stepOps = map[topdown.Op]bool{
+	topdown.EnterOp: true,
+	topdown.EvalOp:  true,
+	topdown.RedoOp:  true,
+	topdown.UnifyOp: true,
+}
+
+// stepLimiter is a query tracer to cancel evaluation when the number of evaluation steps exceeds the limit. A new limiter is created for each evaluation.
+type stepLimiter struct {
+	limit  int64
+	steps  int64
+	cancel context.CancelCauseFunc
+}
+
+func newStepLimiter(limit int64, cancel context.CancelCauseFunc) *stepLimiter {
+	return &stepLimiter{
+		limit:  limit,
+		cancel: cancel,
+	}
+}
+
+// Enabled implements topdown.QueryTracer.
+func (s *stepLimiter) Enabled() bool {
+	return true
+}
+
+// Config implements topdown.QueryTracer.
+func (s *stepLimiter) Config() topdown.TraceConfig {
+	return topdown.TraceConfig{}
+}
+
+// TraceEvent implements topdown.QueryTracer.
+func (s *stepLimiter) TraceEvent(event topdown.Event) {
+	if !stepOps[event.Op] {
+		return
+	}
+
+	s.steps++
+	if s.steps == s.limit+1 {
+		s.cancel(&LimitError{
+			Err:   ErrMaxEvalSteps,
+			Limit: s.limit,
+		})
+	}
+}
+
+var _ topdown.QueryTracer = (*stepLimiter)(nil)
@@ -0,0 +1,186 @@
+package opac_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+const expensivePolicy = `package expensive
+
+cheap := input.n + 1
+
+heavy := count({x |
+	some i, j
+	numbers.range(1, 3000)[i]
+	numbers.range(1, 3000)[j]
+	x := i * j
+})
+
+large := [x | some x in numbers.range(1, 1000)]
+`
+
+func TestQueryTimeout(t *testing.T) {
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": expensivePolicy}),
+		opac.WithQueryTimeout(50*time.Millisecond),
+	)).NoError(t)
+
+	t.Run("exceeded", func(t *testing.T) {
+		var out int
+		err := client.Query(context.Background(), "data.expensive.heavy", nil, &out)
+		gt.True(t, errors.Is(err, opac.ErrQueryTimeout))
+		var limitErr *opac.LimitError
+		gt.True(t, errors.As(err, &limitErr))
+		gt.Equal(t, limitErr.Limit, int64(50*time.Millisecond))
+	})
+
+	t.Run("not exceeded", func(t *testing.T) {
+		var out int
+		gt.NoError(t, client.Query(context.Background(), "data.expensive.cheap", map[string]any{"n": 1}, &out))
+		gt.Equal(t, out, 2)
+	})
+
+	t.Run("shorter deadline of caller", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		var out int
+		err := client.Query(ctx, "data.expensive.heavy", nil, &out)
+		gt.Error(t, err)
+		gt.False(t, errors.Is(err, opac.ErrQueryTimeout))
+	})
+
+	t.Run("result set", func(t *testing.T) {
+		_, err := client.QueryResultSet(context.Background(), "x := data.expensive.heavy", nil)
+		gt.True(t, errors.Is(err, opac.ErrQueryTimeout))
+	})
+
+	t.Run("failure policy", func(t *testing.T) {
+		var out int
+		err := client.Query(context.Background(), "data.expensive.heavy", nil, &out,
+			opac.WithQueryFailurePolicy(opac.FailClosed()))
+		var failClosed *opac.FailClosedError
+		gt.True(t, errors.As(err, &failClosed))
+		gt.True(t, errors.Is(err, opac.ErrQueryTimeout))
+	})
+}
+
+func TestQueryTimeoutRemote(t *testing.T) {
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		},
+	}
+	client := gt.R1(opac.New(
+		opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)),
+		opac.WithQueryTimeout(10*time.Millisecond),
+	)).NoError(t)
+
+	var out bool
+	err := client.Query(context.Background(), "data.authz.allow", nil, &out)
+	gt.True(t, errors.Is(err, opac.ErrQueryTimeout))
+	gt.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestMaxEvalSteps(t *testing.T) {
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": expensivePolicy}),
+		opac.WithMaxEvalSteps(10000),
+	)).NoError(t)
+
+	var out int
+	err := client.Query(context.Background(), "data.expensive.heavy", nil, &out)
+	gt.True(t, errors.Is(err, opac.ErrMaxEvalSteps))
+	gt.False(t, errors.Is(err, opac.ErrQueryTimeout))
+
+	gt.NoError(t, client.Query(context.Background(), "data.expensive.cheap", map[string]any{"n": 1}, &out))
+	gt.Equal(t, out, 2)
+}
+
+func TestMaxEvalStepsIteration(t *testing.T) {
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": "package expensive\n"}),
+		opac.WithMaxEvalSteps(1000),
+	)).NoError(t)
+
+	// Iteration over a builtin generator emits no Eval event for each element
+	var out int
+	err := client.Query(context.Background(), "n := count([x | some x in numbers.range(1, 1000000)])", nil, &out)
+	gt.True(t, errors.Is(err, opac.ErrMaxEvalSteps))
+}
+
+func TestMaxInputSize(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		client := gt.R1(opac.New(
+			opac.Data(map[string]string{"policy.rego": expensivePolicy}),
+			opac.WithMaxInputSize(64),
+		)).NoError(t)
+
+		var out int
+		gt.NoError(t, client.Query(context.Background(), "data.expensive.cheap", map[string]any{"n": 1}, &out))
+		err := client.Query(context.Background(), "data.expensive.cheap", map[string]any{"n": 1, "pad": strings.Repeat("x", 64)}, &out)
+		gt.True(t, errors.Is(err, opac.ErrMaxInputSize))
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		mock := &httpMock{
+			do: func(req *http.Request) (*http.Response, error) {
+				t.Error("request must not be sent")
+				return nil, errors.New("unexpected request")
+			},
+		}
+		client := gt.R1(opac.New(
+			opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)),
+			opac.WithMaxInputSize(64),
+		)).NoError(t)
+
+		var out bool
+		err := client.Query(context.Background(), "data.authz.allow", map[string]any{"pad": strings.Repeat("x", 64)}, &out)
+		gt.True(t, errors.Is(err, opac.ErrMaxInputSize))
+	})
+}
+
+func TestMaxOutputSize(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		client := gt.R1(opac.New(
+			opac.Data(map[string]string{"policy.rego": expensivePolicy}),
+			opac.WithMaxOutputSize(1024),
+		)).NoError(t)
+
+		var out []int
+		err := client.Query(context.Background(), "data.expensive.large", nil, &out)
+		gt.True(t, errors.Is(err, opac.ErrMaxOutputSize))
+		_, err = client.QueryResultSet(context.Background(), "x := data.expensive.large", nil)
+		gt.True(t, errors.Is(err, opac.ErrMaxOutputSize))
+
+		var n int
+		gt.NoError(t, client.Query(context.Background(), "data.expensive.cheap", map[string]any{"n": 1}, &n))
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		mock := &httpMock{
+			do: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(`{"result": "` + strings.Repeat("x", 1024) + `"}`)),
+				}, nil
+			},
+		}
+		client := gt.R1(opac.New(
+			opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)),
+			opac.WithMaxOutputSize(1024),
+		)).NoError(t)
+
+		var out string
+		err := client.Query(context.Background(), "data.authz.reason", nil, &out)
+		gt.True(t, errors.Is(err, opac.ErrMaxOutputSize))
+	})
+}
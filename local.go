@@ -2,40 +2,200 @@ package opac
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sync/atomic"
 
 	"github.com/open-policy-agent/opa/v1/ast"
 	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage"
+	"github.com/open-policy-agent/opa/v1/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-type fileSource struct {
-	cfg      *config
-	paths    []string
+// policySet is a compiled set of policies and base documents evaluated by local sources.
+type policySet struct {
 	compiler *ast.Compiler
+	store    storage.Store
+	revision string
+	warnings []*RegoError
+}
+
+// localEngine evaluates queries against the compiled policy set. It is embedded by local sources to implement Source. The policy set can be swapped atomically while queries are evaluated.
+type localEngine struct {
+	cfg      *config
+	policies atomic.Pointer[policySet]
+	cache    *queryCache
+}
+
+func (e *localEngine) setPolicies(cfg *config, policies *policySet) {
+	e.cfg = cfg
+	e.cache = newQueryCache(cfg.queryCacheSize, policies)
+	e.policies.Store(policies)
+}
+
+// configurePolicies loads and sets the initial policy set. Loading is traced as a span of compiling policies.
+func (e *localEngine) configurePolicies(cfg *config, load func() (*policySet, error)) error {
+	_, span := cfg.tracer.Start(context.Background(), "opac.Compile")
+	policies, err := load()
+	if err == nil {
+		span.SetAttributes(attribute.String("opac.revision", policies.revision))
+	}
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	e.setPolicies(cfg, policies)
+	return nil
+}
+
+// reload loads a new policy set and swaps it only if loading succeeds. Otherwise the current policy set is kept. The result is reported through the logger, the reload callback and a span of reloading.
+func (e *localEngine) reload(load func() (*policySet, error)) {
+	_, span := e.cfg.tracer.Start(context.Background(), "opac.Reload")
+	policies, err := load()
+	endSpan(span, err)
+	e.cfg.metrics.ObserveReload(err == nil)
+	if err != nil {
+		e.cfg.logger.Error("Failed to reload policies, keep serving the current policies", "error", err, "revision", e.Revision())
+		e.notifyReload(ReloadEvent{Revision: e.Revision(), Err: err})
+		return
+	}
+
+	e.policies.Store(policies)
+	e.cache.reset(policies)
+	e.cfg.logger.Info("Policies are reloaded", "revision", policies.revision)
+	e.notifyReload(ReloadEvent{Revision: policies.revision})
+}
+
+func (e *localEngine) notifyReload(event ReloadEvent) {
+	if e.cfg.reloadCallback != nil {
+		e.cfg.reloadCallback(event)
+	}
 }
 
 // AnnotationSet implements Source.
-func (f *fileSource) AnnotationSet() *ast.AnnotationSet {
-	return f.compiler.GetAnnotationSet()
+func (e *localEngine) AnnotationSet() *ast.AnnotationSet {
+	return e.policies.Load().compiler.GetAnnotationSet()
+}
+
+// Revision implements Source.
+func (e *localEngine) Revision() string {
+	return e.policies.Load().revision
+}
+
+// Warnings implements Source.
+func (e *localEngine) Warnings() []*RegoError {
+	return e.policies.Load().warnings
+}
+
+// Query implements Source.
+func (e *localEngine) Query(ctx context.Context, query string, input any, output any, opt queryOptions) error {
+	return queryLocal(ctx, e.cfg, e.policies.Load(), e.cache, query, input, output, opt)
+}
+
+// QueryResultSet implements Source.
+func (e *localEngine) QueryResultSet(ctx context.Context, query string, input any, opt queryOptions) (ResultSet, error) {
+	return queryLocalResultSet(ctx, e.cfg, e.policies.Load(), e.cache, query, input, opt)
+}
+
+// policyFiles collects policy modules and base documents read from files. It is shared by sources reading a file tree to keep the same discovery rules.
+type policyFiles struct {
+	modules   map[string]string
+	documents map[string]any
+}
+
+func newPolicyFiles() *policyFiles {
+	return &policyFiles{
+		modules:   map[string]string{},
+		documents: map[string]any{},
+	}
+}
+
+// isPolicyFile returns true if the file should be loaded: a Rego file (.rego) or a base document file (data.json or data.yaml).
+func isPolicyFile(name string) bool {
+	return path.Ext(name) == ".rego" || isDataFile(name)
+}
+
+// add adds content of the file. The dir is the slash separated directory of the file relative to the given root, and is used as the path of base document.
+func (p *policyFiles) add(name, dir string, raw []byte) error {
+	if !isDataFile(name) {
+		p.modules[name] = string(raw)
+		return nil
+	}
+
+	doc, err := parseDocument(raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse data file %s: %w", name, err)
+	}
+	if err := mergeDocument(p.documents, dataPath(dir), doc); err != nil {
+		return fmt.Errorf("failed to load data file %s: %w", name, err)
+	}
+	return nil
+}
+
+// policySet compiles the modules and creates the policy set.
+func (p *policyFiles) policySet(cfg *config) (*policySet, error) {
+	if len(p.modules) == 0 {
+		return nil, ErrNoPolicyData
+	}
+
+	compiler, warnings, err := compilePolicies(cfg, p.modules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &policySet{
+		compiler: compiler,
+		store:    newStore(p.documents),
+		warnings: warnings,
+	}, nil
+}
+
+type fileSource struct {
+	localEngine
+	paths   []string
+	watcher *watcher
 }
 
 // Configure implements Source.
 func (f *fileSource) Configure(cfg *config) error {
-	policies := map[string]string{}
+	if err := f.configurePolicies(cfg, func() (*policySet, error) { return f.load(cfg) }); err != nil {
+		return err
+	}
+
+	if cfg.watchInterval > 0 {
+		f.watcher = startWatcher(cfg, cfg.watchInterval,
+			func() (fileStamps, error) {
+				return statFiles(f.paths, isPolicyFile)
+			},
+			func() {
+				f.reload(func() (*policySet, error) { return f.load(cfg) })
+			},
+		)
+	}
+
+	return nil
+}
+
+// Close stops watching policy files.
+func (f *fileSource) Close() error {
+	f.watcher.stop()
+	return nil
+}
+
+func (f *fileSource) load(cfg *config) (*policySet, error) {
+	files := newPolicyFiles()
 	for _, dirPath := range f.paths {
 		cfg.logger.Debug("Importing policy files/dirs", "path", dirPath)
 		err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			if d.IsDir() {
-				return nil
-			}
-			if filepath.Ext(path) != ".rego" {
+			if d.IsDir() || !isPolicyFile(filepath.ToSlash(path)) {
 				return nil
 			}
 
@@ -46,44 +206,28 @@ func (f *fileSource) Configure(cfg *config) error {
 				return fmt.Errorf("failed to read policy file: %w", err)
 			}
 
-			policies[fpath] = string(raw)
+			// A file given directly is placed at the root of data.
+			rel := "."
+			if fpath != filepath.Clean(dirPath) {
+				if rel, err = filepath.Rel(dirPath, filepath.Dir(fpath)); err != nil {
+					return fmt.Errorf("failed to get relative path of policy file: %w", err)
+				}
+			}
 
-			return nil
+			return files.add(fpath, filepath.ToSlash(rel), raw)
 		})
 		if err != nil {
-			return fmt.Errorf("failed to walk directory: %w", err)
+			return nil, fmt.Errorf("failed to walk directory: %w", err)
 		}
 	}
+	cfg.logger.Debug("Policy files are loaded", "file count", len(files.modules))
 
-	if len(policies) == 0 {
-		return ErrNoPolicyData
-	}
-	cfg.logger.Debug("Policy files are loaded", "file count", len(policies))
-
-	compiler, err := ast.CompileModulesWithOpt(policies, ast.CompileOpts{
-		EnablePrintStatements: true,
-		ParserOptions: ast.ParserOptions{
-			ProcessAnnotation: true,
-			RegoVersion:       ast.DefaultRegoVersion,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to compile policy: %w", err)
-	}
-
-	f.compiler = compiler
-	f.cfg = cfg
-	return nil
-}
-
-// Query implements Source.
-func (f *fileSource) Query(ctx context.Context, query string, input any, output any, opt queryOptions) error {
-	return queryLocal(ctx, f.cfg, f.compiler, query, input, output, opt)
+	return files.policySet(cfg)
 }
 
 var _ Source = (*fileSource)(nil)
 
-// Files is an option to specify the file path to read rego files. If path is a directory, it reads all files with the .rego extension in the directory.
+// Files is an option to specify the file path to read rego files. If path is a directory, it reads all files with the .rego extension in the directory. Base documents in data.json and data.yaml files are also loaded and placed under the directory path relative to the given path, in the same manner as OPA bundles. For example, "policy_dir/roles/data.json" is loaded as data.roles when "policy_dir" is given.
 //
 // Example:
 //
@@ -111,83 +255,190 @@ func Files(paths ...string) Source {
 //	 }
 //
 //	client, err := opac.New(opac.Data(policies))
-func Data(policies map[string]string) Source {
-	return &dataSource{
-		policies: policies,
+func Data(policies map[string]string, options ...DataOption) Source {
+	src := &dataSource{
+		modules: policies,
 	}
+	for _, opt := range options {
+		opt(src)
+	}
+	return src
 }
 
-type dataSource struct {
-	cfg      *config
-	policies map[string]string
-	compiler *ast.Compiler
+// DataOption is a function that configures the Data source.
+type DataOption func(*dataSource)
+
+// WithDocuments sets base documents that are referred as data.* from policies. The documents is the root of data, and the values are converted in the same manner as JSON encoding. It can be called multiple times and objects are merged.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Data(policies, opac.WithDocuments(map[string]any{
+//		"roles": map[string]any{"alice": "admin"},
+//	})))
+func WithDocuments(documents map[string]any) DataOption {
+	return func(d *dataSource) {
+		d.documents = append(d.documents, documents)
+	}
 }
 
-// AnnotationSet implements Source.
-func (d *dataSource) AnnotationSet() *ast.AnnotationSet {
-	return d.compiler.GetAnnotationSet()
+type dataSource struct {
+	localEngine
+	modules   map[string]string
+	documents []map[string]any
 }
 
 // Configure implements Source.
 func (d *dataSource) Configure(cfg *config) error {
-	if len(d.policies) == 0 {
-		return ErrNoPolicyData
+	return d.configurePolicies(cfg, func() (*policySet, error) { return d.load(cfg) })
+}
+
+func (d *dataSource) load(cfg *config) (*policySet, error) {
+	if len(d.modules) == 0 {
+		return nil, ErrNoPolicyData
+	}
+	cfg.logger.Debug("Policy data are loaded", "data count", len(d.modules))
+
+	documents := map[string]any{}
+	for _, doc := range d.documents {
+		var v any = doc
+		if err := util.RoundTrip(&v); err != nil {
+			return nil, fmt.Errorf("failed to convert base document: %w", err)
+		}
+		if err := mergeDocument(documents, nil, v); err != nil {
+			return nil, fmt.Errorf("failed to load base document: %w", err)
+		}
 	}
-	cfg.logger.Debug("Policy data are loaded", "data count", len(d.policies))
 
-	compiler, err := ast.CompileModulesWithOpt(d.policies, ast.CompileOpts{
-		EnablePrintStatements: true,
-		ParserOptions: ast.ParserOptions{
-			ProcessAnnotation: true,
-		},
-	})
+	compiler, warnings, err := compilePolicies(cfg, d.modules)
 	if err != nil {
-		return fmt.Errorf("failed to compile policy: %w", err)
+		return nil, err
 	}
 
-	d.compiler = compiler
-	d.cfg = cfg
+	return &policySet{
+		compiler: compiler,
+		store:    newStore(documents),
+		warnings: warnings,
+	}, nil
+}
 
-	return nil
+var _ Source = (*dataSource)(nil)
+
+func queryLocal(ctx context.Context, cfg *config, policies *policySet, cache *queryCache, query string, input, output any, opt queryOptions) error {
+	rs, err := evalLocal(ctx, cfg, policies, cache, query, input, opt)
+	if err != nil {
+		return err
+	}
+
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return ErrNoEvalResult
+	}
+
+	value := rs[0].Expressions[0].Value
+	if err := checkEncodedSize(ErrMaxOutputSize, cfg.maxOutputSize, value); err != nil {
+		return err
+	}
+
+	return newDecodeError(decodeResult(value, output))
 }
 
-// Query implements Source.
-func (d *dataSource) Query(ctx context.Context, query string, input any, output any, opt queryOptions) error {
-	return queryLocal(ctx, d.cfg, d.compiler, query, input, output, opt)
+// queryLocalResultSet evaluates the query and converts all results into ResultSet.
+func queryLocalResultSet(ctx context.Context, cfg *config, policies *policySet, cache *queryCache, query string, input any, opt queryOptions) (ResultSet, error) {
+	rs, err := evalLocal(ctx, cfg, policies, cache, query, input, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(ResultSet, 0, len(rs))
+	for _, r := range rs {
+		result := Result{
+			Expressions: make([]*Expression, 0, len(r.Expressions)),
+			Bindings:    make(map[string]any, len(r.Bindings)),
+		}
+		for _, expr := range r.Expressions {
+			var value any
+			if err := decodeResult(expr.Value, &value); err != nil {
+				return nil, newDecodeError(err)
+			}
+			result.Expressions = append(result.Expressions, &Expression{
+				Value: value,
+				Text:  expr.Text,
+			})
+		}
+		for name, v := range r.Bindings {
+			var value any
+			if err := decodeResult(v, &value); err != nil {
+				return nil, newDecodeError(err)
+			}
+			result.Bindings[name] = value
+		}
+		results = append(results, result)
+	}
+
+	if err := checkEncodedSize(ErrMaxOutputSize, cfg.maxOutputSize, results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
 }
 
-var _ Source = (*dataSource)(nil)
+// evalLocal evaluates the query with the policy set and returns the raw result set.
+func evalLocal(ctx context.Context, cfg *config, policies *policySet, cache *queryCache, query string, input any, opt queryOptions) (rego.ResultSet, error) {
+	if err := checkEncodedSize(ErrMaxInputSize, cfg.maxInputSize, input); err != nil {
+		return nil, err
+	}
 
-func queryLocal(ctx context.Context, cfg *config, compiler *ast.Compiler, query string, input, output any, opt queryOptions) error {
-	options := []func(r *rego.Rego){
-		rego.Query(query),
-		rego.Compiler(compiler),
-		rego.Input(input),
+	q, err := prepareQuery(ctx, cfg, policies, cache, query)
+	if err != nil {
+		return nil, err
 	}
 
+	evalOptions := []rego.EvalOption{}
+	if cfg.maxEvalSteps > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		evalOptions = append(evalOptions, rego.EvalQueryTracer(newStepLimiter(cfg.maxEvalSteps, cancel)))
+	}
+	if v, ok := input.(ast.Value); ok {
+		evalOptions = append(evalOptions, rego.EvalParsedInput(v))
+	} else {
+		evalOptions = append(evalOptions, rego.EvalInput(input))
+	}
 	if opt.printHook != nil {
 		cfg.logger.Debug("Setting print hook")
-		options = append(options, rego.PrintHook(opt.printHook))
+		evalOptions = append(evalOptions, rego.EvalPrintHook(opt.printHook))
 	}
 
-	q := rego.New(options...)
-
-	rs, err := q.Eval(ctx)
+	rs, err := q.Eval(ctx, evalOptions...)
 	if err != nil {
-		return fmt.Errorf("failed to evaluate query: %w", err)
+		return nil, limitCause(ctx, newEvalError(err))
 	}
 
-	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
-		return ErrNoEvalResult
+	return rs, nil
+}
+
+// prepareQuery returns the prepared query from the cache, or prepares and caches it. The print hook is given at evaluation time, so the query string is enough as the cache key.
+func prepareQuery(ctx context.Context, cfg *config, policies *policySet, cache *queryCache, query string) (rego.PreparedEvalQuery, error) {
+	q, ok := cache.get(policies, query)
+	if cache.enabled() {
+		cfg.metrics.ObserveQueryCache(ok)
+	}
+	if ok {
+		return q, nil
 	}
 
-	raw, err := json.Marshal(rs[0].Expressions[0].Value)
-	if err != nil {
-		return fmt.Errorf("failed to marshal result: %w", err)
+	cfg.logger.Debug("Preparing query", "query", query)
+	options := []func(*rego.Rego){
+		rego.Query(query),
+		rego.Compiler(policies.compiler),
+		rego.Store(policies.store),
 	}
-	if err := json.Unmarshal(raw, output); err != nil {
-		return fmt.Errorf("failed to unmarshal result: %w", err)
+	q, err := rego.New(append(options, builtinOptions(cfg.builtins)...)...).PrepareForEval(ctx)
+	if err != nil {
+		cfg.capabilities.explainForbiddenCalls(err)
+		return rego.PreparedEvalQuery{}, newCompileError("failed to prepare query", err)
 	}
 
-	return nil
+	cache.put(policies, query, q)
+	return q, nil
 }
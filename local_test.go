@@ -78,6 +78,94 @@ func TestLocal(t *testing.T) {
 	}))
 }
 
+func TestDocuments(t *testing.T) {
+	type testCase struct {
+		src    opac.Source
+		input  map[string]any
+		expect bool
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			client := gt.R1(opac.New(tc.src)).NoError(t)
+
+			var output struct {
+				Allow bool `json:"allow"`
+			}
+			gt.NoError(t, client.Query(context.Background(), "data.authz", tc.input, &output))
+			gt.Equal(t, output.Allow, tc.expect)
+		}
+	}
+
+	policy := `package authz
+allow if { data.roles[input.user] == "admin" }
+allow if { input.ip in data.allowlist.ips }
+`
+
+	t.Run("files: allowed by data.json", doTest(testCase{
+		src:    opac.Files("testdata/documents"),
+		input:  map[string]any{"user": "alice"},
+		expect: true,
+	}))
+
+	t.Run("files: allowed by data.yaml", doTest(testCase{
+		src:    opac.Files("testdata/documents"),
+		input:  map[string]any{"user": "bob", "ip": "10.0.0.2"},
+		expect: true,
+	}))
+
+	t.Run("files: not allowed", doTest(testCase{
+		src:    opac.Files("testdata/documents"),
+		input:  map[string]any{"user": "bob", "ip": "192.168.0.1"},
+		expect: false,
+	}))
+
+	t.Run("data: allowed by documents", doTest(testCase{
+		src: opac.Data(map[string]string{"policy.rego": policy},
+			opac.WithDocuments(map[string]any{
+				"roles": map[string]string{"alice": "admin"},
+			}),
+			opac.WithDocuments(map[string]any{
+				"allowlist": map[string]any{"ips": []string{"10.0.0.1"}},
+			}),
+		),
+		input:  map[string]any{"user": "bob", "ip": "10.0.0.1"},
+		expect: true,
+	}))
+
+	t.Run("data: not allowed without documents", doTest(testCase{
+		src:    opac.Data(map[string]string{"policy.rego": policy}),
+		input:  map[string]any{"user": "alice"},
+		expect: false,
+	}))
+}
+
+func TestDocumentsPlacement(t *testing.T) {
+	client := gt.R1(opac.New(opac.Files("testdata/documents"))).NoError(t)
+
+	var output map[string]any
+	gt.NoError(t, client.Query(context.Background(), "data", nil, &output))
+	gt.Equal(t, output["version"], any("1"))
+	gt.Equal(t, output["roles"], any(map[string]any{"alice": "admin", "bob": "viewer"}))
+
+	// data file given directly is placed at the root
+	client = gt.R1(opac.New(opac.Files(
+		"testdata/documents/policy.rego",
+		"testdata/documents/roles/data.json",
+	))).NoError(t)
+	var role string
+	gt.NoError(t, client.Query(context.Background(), "data.alice", nil, &role))
+	gt.Equal(t, role, "admin")
+}
+
+func TestDocumentsConflict(t *testing.T) {
+	_, err := opac.New(opac.Data(map[string]string{"policy.rego": "package x"},
+		opac.WithDocuments(map[string]any{"roles": map[string]any{"alice": "admin"}}),
+		opac.WithDocuments(map[string]any{"roles": map[string]any{"alice": "viewer"}}),
+	))
+	gt.Error(t, err)
+}
+
 func TestMetadata(t *testing.T) {
 	p, err := opac.New(opac.Files("testdata/metadata/pkg.rego"))
 	gt.NoError(t, err)
@@ -0,0 +1,156 @@
+package opac
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// MaskFunc is a custom function to mask a document before it is logged or exported. The document has "input" and "result" keys, and the function can modify it in place. The document is a copy, so modifying it does not affect the input and output of the query.
+type MaskFunc func(doc map[string]any)
+
+// WithMask sets paths of values to be removed before inputs and results are logged or exported, including debug logs of Remote source and decision logs. A path is a JSON pointer such as "/input/password" or a Rego reference such as `input.password` and `input["api-key"]`, and it must start with input or result. Only keys of objects can be removed. Removed paths are recorded in Erased of decision logs.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Remote(opaServerURL),
+//		opac.WithMask("/input/password", `input.headers["x-api-key"]`),
+//	)
+func WithMask(paths ...string) Option {
+	return func(cfg *config) {
+		if cfg.mask == nil {
+			cfg.mask = &masker{}
+		}
+		cfg.mask.rawPaths = append(cfg.mask.rawPaths, paths...)
+	}
+}
+
+// WithMaskFunc sets a custom function to mask inputs and results. It is called after paths set by WithMask are removed.
+func WithMaskFunc(fn MaskFunc) Option {
+	return func(cfg *config) {
+		if cfg.mask == nil {
+			cfg.mask = &masker{}
+		}
+		cfg.mask.fn = fn
+	}
+}
+
+// masker removes sensitive values from documents to be logged or exported. A nil masker does nothing.
+type masker struct {
+	rawPaths []string
+	paths    []maskPath
+	fn       MaskFunc
+}
+
+type maskPath struct {
+	raw  string
+	keys []string
+}
+
+// parse parses paths given by WithMask. It must be called before apply.
+func (m *masker) parse() error {
+	if m == nil {
+		return nil
+	}
+
+	m.paths = make([]maskPath, 0, len(m.rawPaths))
+	for _, raw := range m.rawPaths {
+		keys, err := parseMaskPath(raw)
+		if err != nil {
+			return fmt.Errorf("invalid mask path '%s': %w", raw, err)
+		}
+		m.paths = append(m.paths, maskPath{raw: raw, keys: keys})
+	}
+	return nil
+}
+
+// parseMaskPath parses a JSON pointer or a Rego reference into keys.
+func parseMaskPath(path string) ([]string, error) {
+	var keys []string
+	if strings.HasPrefix(path, "/") {
+		for _, key := range strings.Split(path[1:], "/") {
+			keys = append(keys, strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~"))
+		}
+	} else {
+		ref, err := ast.ParseRef(path)
+		if err != nil {
+			return nil, err
+		}
+		for i, term := range ref {
+			switch v := term.Value.(type) {
+			case ast.Var:
+				if i != 0 {
+					return nil, fmt.Errorf("variable is not allowed in path")
+				}
+				keys = append(keys, string(v))
+			case ast.String:
+				keys = append(keys, string(v))
+			default:
+				return nil, fmt.Errorf("only string keys are allowed in path")
+			}
+		}
+	}
+
+	if len(keys) < 2 || (keys[0] != "input" && keys[0] != "result") {
+		return nil, fmt.Errorf("path must start with input or result and have a key")
+	}
+	return keys, nil
+}
+
+// apply removes masked paths from the document and calls the custom function. The document must consist of the types produced by JSON decoding. It returns the removed paths.
+func (m *masker) apply(doc map[string]any) []string {
+	if m == nil {
+		return nil
+	}
+
+	var erased []string
+	for _, path := range m.paths {
+		if removeKeys(doc, path.keys) {
+			erased = append(erased, path.raw)
+		}
+	}
+	if m.fn != nil {
+		m.fn(doc)
+	}
+	return erased
+}
+
+// maskJSON masks a JSON body having "input" or "result" key, such as a request body and a response body of OPA server, for logging. The body is returned as it is if no mask is set, and it is omitted if it can not be parsed.
+func (m *masker) maskJSON(body []byte) string {
+	if m == nil {
+		return string(body)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "(omitted by mask)"
+	}
+	m.apply(doc)
+
+	masked, err := json.Marshal(doc)
+	if err != nil {
+		return "(omitted by mask)"
+	}
+	return string(masked)
+}
+
+// removeKeys removes the value at the keys from the document. It returns true if the value existed.
+func removeKeys(doc map[string]any, keys []string) bool {
+	current := doc
+	for i, key := range keys {
+		next, ok := current[key]
+		if !ok {
+			return false
+		}
+		if i == len(keys)-1 {
+			delete(current, key)
+			return true
+		}
+		if current, ok = next.(map[string]any); !ok {
+			return false
+		}
+	}
+	return false
+}
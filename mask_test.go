@@ -0,0 +1,142 @@
+package opac_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+func TestMaskRemoteLog(t *testing.T) {
+	type testCase struct {
+		options      []opac.Option
+		expectInput  map[string]any
+		expectResult map[string]any
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			w := &logWriter{buf: new(bytes.Buffer)}
+			logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+				Level: slog.LevelDebug,
+			}))
+
+			mock := &httpMock{
+				do: func(req *http.Request) (*http.Response, error) {
+					// The request sent to OPA server is not masked
+					var body struct {
+						Input map[string]any `json:"input"`
+					}
+					gt.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+					gt.Equal(t, body.Input["password"], any("secret"))
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(strings.NewReader(`{"result": {"allow": true, "token": "xyz"}}`)),
+					}, nil
+				},
+			}
+			options := append([]opac.Option{opac.WithLogger(logger)}, tc.options...)
+			client := gt.R1(opac.New(
+				opac.Remote("http://example.com/v1", opac.WithHTTPClient(mock)),
+				options...,
+			)).NoError(t)
+
+			input := map[string]any{
+				"user":     "alice",
+				"password": "secret",
+				"headers":  map[string]any{"x-api-key": "key", "accept": "*/*"},
+			}
+			var output struct {
+				Allow bool   `json:"allow"`
+				Token string `json:"token"`
+			}
+			gt.NoError(t, client.Query(context.Background(), "data.authz", input, &output))
+			gt.Equal(t, output.Token, "xyz")
+
+			decoder := json.NewDecoder(bytes.NewReader(w.buf.Bytes()))
+			var sent, received map[string]any
+			gt.NoError(t, decoder.Decode(&sent))
+			gt.NoError(t, decoder.Decode(&received))
+
+			var sentBody, receivedBody map[string]any
+			gt.NoError(t, json.Unmarshal([]byte(sent["body"].(string)), &sentBody))
+			gt.NoError(t, json.Unmarshal([]byte(received["body"].(string)), &receivedBody))
+			gt.Equal(t, sentBody["input"], any(tc.expectInput))
+			gt.Equal(t, receivedBody["result"], any(tc.expectResult))
+		}
+	}
+
+	t.Run("no mask", doTest(testCase{
+		expectInput: map[string]any{
+			"user":     "alice",
+			"password": "secret",
+			"headers":  map[string]any{"x-api-key": "key", "accept": "*/*"},
+		},
+		expectResult: map[string]any{"allow": true, "token": "xyz"},
+	}))
+
+	t.Run("JSON pointer and Rego reference", doTest(testCase{
+		options: []opac.Option{
+			opac.WithMask("/input/password", `input.headers["x-api-key"]`, "result.token"),
+		},
+		expectInput: map[string]any{
+			"user":    "alice",
+			"headers": map[string]any{"accept": "*/*"},
+		},
+		expectResult: map[string]any{"allow": true},
+	}))
+
+	t.Run("custom function", doTest(testCase{
+		options: []opac.Option{
+			opac.WithMask("/input/password"),
+			opac.WithMaskFunc(func(doc map[string]any) {
+				if input, ok := doc["input"].(map[string]any); ok {
+					input["user"] = "***"
+					delete(input, "headers")
+				}
+			}),
+		},
+		expectInput:  map[string]any{"user": "***"},
+		expectResult: map[string]any{"allow": true, "token": "xyz"},
+	}))
+}
+
+func TestMaskDecisionLog(t *testing.T) {
+	sink := &memorySink{}
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithDecisionLogger(sink),
+		opac.WithMask("input.password"),
+		opac.WithMaskFunc(func(doc map[string]any) {
+			doc["result"] = "redacted"
+		}),
+	)).NoError(t)
+
+	var allow bool
+	gt.NoError(t, client.Query(context.Background(), "data.authz.allow", map[string]any{"user": "alice", "password": "secret"}, &allow))
+	gt.True(t, allow)
+	gt.NoError(t, client.Close())
+
+	gt.A(t, sink.logs).Length(1)
+	gt.Equal(t, sink.logs[0].Input, any(map[string]any{"user": "alice"}))
+	gt.Equal(t, sink.logs[0].Result, any("redacted"))
+	gt.Equal(t, sink.logs[0].Erased, []string{"input.password"})
+}
+
+func TestMaskInvalidPath(t *testing.T) {
+	for _, path := range []string{"/password", "data.x", "input[x]", "input.users[0]", "input", "input.["} {
+		_, err := opac.New(
+			opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+			opac.WithMask(path),
+		)
+		gt.Error(t, err)
+	}
+}
@@ -0,0 +1,102 @@
+package opac
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrorCategory is a category of query errors reported to Metrics.
+type ErrorCategory string
+
+const (
+	// ErrorCategoryNone means the query succeeded.
+	ErrorCategoryNone ErrorCategory = ""
+
+	// ErrorCategoryCompile means the query could not be compiled against the policies and *CompileError is returned.
+	ErrorCategoryCompile ErrorCategory = "compile"
+
+	// ErrorCategoryEval means evaluation of the query failed, such as a runtime error of a builtin function, and *EvalError is returned.
+	ErrorCategoryEval ErrorCategory = "eval"
+
+	// ErrorCategoryTransport means the request to OPA server failed or returned an unexpected status code, and *RemoteError is returned.
+	ErrorCategoryTransport ErrorCategory = "transport"
+
+	// ErrorCategoryNoResult means the query returned no result.
+	ErrorCategoryNoResult ErrorCategory = "no_result"
+
+	// ErrorCategoryDecode means the result could not be decoded into the output and *DecodeError is returned.
+	ErrorCategoryDecode ErrorCategory = "decode"
+
+	// ErrorCategoryLimit means the query exceeded a limit such as the query timeout and returned *LimitError.
+	ErrorCategoryLimit ErrorCategory = "limit"
+
+	// ErrorCategoryOther means the error does not belong to the categories above, such as cancellation of the context.
+	ErrorCategoryOther ErrorCategory = "other"
+)
+
+// Metrics receives measurements of the client. Methods are called concurrently from multiple goroutines. NewPrometheusMetrics provides an implementation for Prometheus.
+type Metrics interface {
+	// ObserveQuery is called after every query with the source type, the query, the latency and the category of the error returned by the source. The category is evaluated before the failure policy is applied. The query can be a free-form text given to Client.QueryResultSet or Client.Partial, so it should not be used as a metric label as it is.
+	ObserveQuery(source, query string, latency time.Duration, category ErrorCategory)
+
+	// ObserveRemoteStatus is called for every response from OPA server with the HTTP status code.
+	ObserveRemoteStatus(code int)
+
+	// ObserveReload is called after policies are reloaded in background.
+	ObserveReload(success bool)
+
+	// ObserveQueryCache is called when a local source looks up the prepared query cache.
+	ObserveQueryCache(hit bool)
+}
+
+// WithMetrics sets the metrics to observe queries, remote responses, reloads and the query cache.
+//
+// Example:
+//
+//	metrics, err := opac.NewPrometheusMetrics(prometheus.DefaultRegisterer)
+//	client, err := opac.New(opac.Files("policy"), opac.WithMetrics(metrics))
+func WithMetrics(metrics Metrics) Option {
+	return func(cfg *config) {
+		cfg.metrics = metrics
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveQuery(string, string, time.Duration, ErrorCategory) {}
+func (noopMetrics) ObserveRemoteStatus(int)                                   {}
+func (noopMetrics) ObserveReload(bool)                                        {}
+func (noopMetrics) ObserveQueryCache(bool)                                    {}
+
+// errorCategory returns the category of the error.
+func errorCategory(err error) ErrorCategory {
+	if err == nil {
+		return ErrorCategoryNone
+	}
+	if errors.Is(err, ErrNoEvalResult) {
+		return ErrorCategoryNoResult
+	}
+
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return ErrorCategoryLimit
+	}
+
+	var (
+		compileErr *CompileError
+		evalErr    *EvalError
+		remoteErr  *RemoteError
+		decodeErr  *DecodeError
+	)
+	switch {
+	case errors.As(err, &compileErr):
+		return ErrorCategoryCompile
+	case errors.As(err, &evalErr):
+		return ErrorCategoryEval
+	case errors.As(err, &remoteErr):
+		return ErrorCategoryTransport
+	case errors.As(err, &decodeErr):
+		return ErrorCategoryDecode
+	}
+	return ErrorCategoryOther
+}
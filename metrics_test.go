@@ -0,0 +1,197 @@
+package opac_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queryObservation struct {
+	source   string
+	query    string
+	category opac.ErrorCategory
+}
+
+type metricsRecorder struct {
+	mutex    sync.Mutex
+	queries  []queryObservation
+	statuses []int
+	reloads  []bool
+	cache    []bool
+}
+
+func (m *metricsRecorder) ObserveQuery(source, query string, latency time.Duration, category opac.ErrorCategory) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.queries = append(m.queries, queryObservation{source: source, query: query, category: category})
+}
+
+func (m *metricsRecorder) ObserveRemoteStatus(code int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.statuses = append(m.statuses, code)
+}
+
+func (m *metricsRecorder) ObserveReload(success bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reloads = append(m.reloads, success)
+}
+
+func (m *metricsRecorder) ObserveQueryCache(hit bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cache = append(m.cache, hit)
+}
+
+func TestMetricsLocal(t *testing.T) {
+	policy := `package authz
+
+allow := input.user == "alice"
+fail := 1 if { input.user == "alice" }
+fail := 2 if { input.user == "alice" }
+reason := "admin" if { input.user == "alice" }
+`
+	recorder := &metricsRecorder{}
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": policy}),
+		opac.WithMetrics(recorder),
+	)).NoError(t)
+
+	ctx := context.Background()
+	input := map[string]any{"user": "alice"}
+	var allow bool
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", input, &allow))
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", input, &allow))
+	gt.Error(t, client.Query(ctx, "data.authz.reason", map[string]any{"user": "bob"}, &allow))
+	gt.Error(t, client.Query(ctx, "data.authz.reason", input, &allow))
+	gt.Error(t, client.Query(ctx, "data.authz.allow[", input, &allow))
+
+	var out any
+	err := client.Query(ctx, "data.authz.fail", input, &out, opac.WithQueryFailurePolicy(opac.DefaultOutput(nil)))
+	gt.NoError(t, err)
+
+	gt.Equal(t, recorder.queries, []queryObservation{
+		{source: "data", query: "data.authz.allow", category: opac.ErrorCategoryNone},
+		{source: "data", query: "data.authz.allow", category: opac.ErrorCategoryNone},
+		{source: "data", query: "data.authz.reason", category: opac.ErrorCategoryNoResult},
+		{source: "data", query: "data.authz.reason", category: opac.ErrorCategoryDecode},
+		{source: "data", query: "data.authz.allow[", category: opac.ErrorCategoryCompile},
+		{source: "data", query: "data.authz.fail", category: opac.ErrorCategoryEval},
+	})
+	gt.Equal(t, recorder.cache, []bool{false, true, false, true, false, false})
+}
+
+func TestMetricsRemote(t *testing.T) {
+	statuses := []int{http.StatusOK, http.StatusInternalServerError}
+	var count int
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			status := statuses[count%len(statuses)]
+			count++
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(strings.NewReader(`{"result": true}`)),
+			}, nil
+		},
+	}
+
+	recorder := &metricsRecorder{}
+	client := gt.R1(opac.New(
+		opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)),
+		opac.WithMetrics(recorder),
+	)).NoError(t)
+
+	ctx := context.Background()
+	var allow bool
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", nil, &allow))
+	gt.Error(t, client.Query(ctx, "data.authz.allow", nil, &allow))
+
+	gt.Equal(t, recorder.statuses, []int{http.StatusOK, http.StatusInternalServerError})
+	gt.Equal(t, recorder.queries[0].category, opac.ErrorCategoryNone)
+	gt.Equal(t, recorder.queries[1].category, opac.ErrorCategoryTransport)
+	gt.Equal(t, recorder.queries[1].source, "remote")
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := gt.R1(opac.NewPrometheusMetrics(registry)).NoError(t)
+
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithMetrics(metrics),
+	)).NoError(t)
+
+	ctx := context.Background()
+	var allow bool
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", map[string]any{"user": "alice"}, &allow))
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", map[string]any{"user": "bob"}, &allow))
+	gt.True(t, errors.Is(client.Query(ctx, "data.authz.unknown", nil, &allow), opac.ErrNoEvalResult))
+	gt.R1(client.QueryResultSet(ctx, "x := data.authz.allow", nil)).NoError(t)
+	gt.R1(client.QueryResultSet(ctx, "y := data.authz.allow", nil)).NoError(t)
+	metrics.ObserveRemoteStatus(http.StatusOK)
+	metrics.ObserveReload(false)
+
+	// Ad-hoc queries share one label value
+	gt.Equal(t, testutil.CollectAndCount(registry, "opac_query_duration_seconds"), 3)
+	var queryLabels []string
+	for _, family := range gt.R1(registry.Gather()).NoError(t) {
+		if family.GetName() != "opac_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == "query" {
+					queryLabels = append(queryLabels, pair.GetValue())
+				}
+			}
+		}
+	}
+	gt.A(t, queryLabels).Have("data.authz.allow").Have("data.authz.unknown").Have("adhoc")
+
+	gt.Equal(t, testutil.ToFloat64(mustCounter(t, registry, "opac_query_errors_total", map[string]string{"source": "data", "category": "no_result"})), 1)
+	gt.Equal(t, testutil.ToFloat64(mustCounter(t, registry, "opac_query_cache_total", map[string]string{"result": "hit"})), 1)
+	gt.Equal(t, testutil.ToFloat64(mustCounter(t, registry, "opac_query_cache_total", map[string]string{"result": "miss"})), 4)
+	gt.Equal(t, testutil.ToFloat64(mustCounter(t, registry, "opac_remote_responses_total", map[string]string{"code": "200"})), 1)
+	gt.Equal(t, testutil.ToFloat64(mustCounter(t, registry, "opac_reloads_total", map[string]string{"outcome": "failure"})), 1)
+
+	// Collectors can not be registered twice
+	_, err := opac.NewPrometheusMetrics(registry)
+	gt.Error(t, err)
+}
+
+// mustCounter returns a collector of the metric with the labels from the registry.
+func mustCounter(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) prometheus.Collector {
+	t.Helper()
+	families := gt.R1(registry.Gather()).NoError(t)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, pair := range metric.GetLabel() {
+				if labels[pair.GetName()] == pair.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name}, func() float64 {
+					return metric.GetCounter().GetValue()
+				})
+			}
+		}
+	}
+	t.Fatalf("metric %s %v is not found", name, labels)
+	return nil
+}
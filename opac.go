@@ -2,27 +2,58 @@ package opac
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/open-policy-agent/opa/v1/ast"
 	"github.com/open-policy-agent/opa/v1/topdown/print"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Client is the main interface to interact with the opac library.
+// Client is the main interface to interact with the opac library. A Client is safe for concurrent use by multiple goroutines.
 type Client struct {
-	src Source
+	src            Source
+	cfg            *config
+	decisionLogger *decisionLogger
+	fallbacks      *fallbackSources
 }
 
 type config struct {
-	logger *slog.Logger
+	logger          *slog.Logger
+	queryCacheSize  int
+	watchInterval   time.Duration
+	reloadCallback  func(event ReloadEvent)
+	failurePolicy   FailurePolicy
+	decisionLog     *decisionLogConfig
+	mask            *masker
+	tracer          trace.Tracer
+	propagator      propagation.TextMapPropagator
+	metrics         Metrics
+	queryTimeout    time.Duration
+	maxEvalSteps    int64
+	maxInputSize    int64
+	maxOutputSize   int64
+	builtins        []*builtin
+	capabilities    *capabilities
+	regoVersion     ast.RegoVersion
+	regoVersions    []pathRegoVersion
+	strict          bool
+	compileWarnings bool
+	queryFallbacks  []Source
 }
 
 // Source is a function that returns the policy data. It is used to provide the policy data to the client.
 type Source interface {
 	Configure(cfg *config) error
 	Query(ctx context.Context, query string, input, output any, opt queryOptions) error
+	QueryResultSet(ctx context.Context, query string, input any, opt queryOptions) (ResultSet, error)
+	Partial(ctx context.Context, query string, input any, unknowns []string, opt queryOptions) (*PartialResult, error)
 	AnnotationSet() *ast.AnnotationSet
+	Revision() string
+	Warnings() []*RegoError
 }
 
 // Option is a function that configures the client.
@@ -44,34 +75,134 @@ func (noopWriter) Write(p []byte) (int, error) {
 // New creates a new opac client. It returns an error if neither policy data nor configuration is provided.
 func New(src Source, options ...Option) (*Client, error) {
 	cfg := &config{
-		logger: slog.New(slog.NewTextHandler(&noopWriter{}, nil)),
+		logger:         slog.New(slog.NewTextHandler(&noopWriter{}, nil)),
+		queryCacheSize: defaultQueryCacheSize,
+		tracer:         defaultTracer(),
+		propagator:     defaultPropagator(),
+		metrics:        noopMetrics{},
+		regoVersion:    ast.DefaultRegoVersion,
 	}
 
 	for _, opt := range options {
 		opt(cfg)
 	}
 
+	if err := cfg.mask.parse(); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	if err := validateBuiltins(cfg.builtins); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	if err := cfg.capabilities.resolve(); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	if err := validateRegoVersions(cfg); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
 	if err := src.Configure(cfg); err != nil {
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
+	fallbacks, err := configureFallbacks(cfg)
+	if err != nil {
+		closeSource(src)
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
 
-	return &Client{
-		src: src,
-	}, nil
+	client := &Client{
+		src:       src,
+		cfg:       cfg,
+		fallbacks: fallbacks,
+	}
+	if cfg.decisionLog != nil {
+		client.decisionLogger = newDecisionLogger(cfg.decisionLog, cfg.logger, cfg.mask)
+	}
+
+	return client, nil
 }
 
-// Query evaluates the given query with the provided input and output. The query is evaluated against the policy data provided during client creation.
+// Close stops background tasks of the client and fallback sources, such as watching policy files, and flushes queued decision logs. The client should not be used after Close.
+func (c *Client) Close() error {
+	errs := []error{
+		c.fallbacks.close(),
+		closeSource(c.src),
+	}
+
+	c.decisionLogger.close()
+	return errors.Join(errs...)
+}
+
+// Query evaluates the given query with the provided input and output. The query is evaluated against the policy data provided during client creation. If the evaluation fails or returns no result, the failure policy decides the result.
 func (c *Client) Query(ctx context.Context, query string, input, output any, options ...QueryOption) error {
 	opt := queryOptions{}
 	for _, o := range options {
 		o(&opt)
 	}
 
-	return c.src.Query(ctx, query, input, output, opt)
+	ctx, span := c.startQuerySpan(ctx, "opac.Query", query)
+
+	start := time.Now()
+	path := PathEvaluated
+	decidedBy := c.src
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	err := limitCause(queryCtx, c.src.Query(queryCtx, query, input, output, opt))
+	cancel()
+	c.cfg.metrics.ObserveQuery(sourceType(c.src), query, time.Since(start), errorCategory(err))
+
+	if err != nil {
+		policy := c.cfg.failurePolicy
+		if opt.failurePolicy != nil {
+			policy = *opt.failurePolicy
+		}
+
+		// The fallback source has its own timeout
+		fallbackCtx, cancel := c.withQueryTimeout(ctx)
+		path, err = policy.apply(fallbackCtx, c.cfg, c.fallbacks, query, input, output, opt, err)
+		err = limitCause(fallbackCtx, err)
+		cancel()
+		if path == PathFallback {
+			decidedBy = policy.fallback
+		}
+	}
+
+	if opt.decisionPath != nil {
+		*opt.decisionPath = path
+	}
+	c.endQuerySpan(span, err == nil, path, err)
+
+	if c.decisionLogger != nil {
+		var result any
+		if err == nil {
+			result = output
+		}
+		c.logDecision(decidedBy, start, query, input, result, path, err)
+	}
+	return err
+}
+
+// logDecision records the decision log if decision logging is enabled. The src is the source that decided the result, such as the fallback source.
+func (c *Client) logDecision(src Source, start time.Time, query string, input, result any, path DecisionPath, err error) {
+	entry := &DecisionLog{
+		Query:     query,
+		Input:     input,
+		Result:    result,
+		Source:    sourceType(src),
+		Revision:  src.Revision(),
+		Path:      path,
+		Timestamp: start,
+		Latency:   time.Since(start),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	c.decisionLogger.record(entry)
 }
 
 type queryOptions struct {
-	printHook print.Hook
+	printHook     print.Hook
+	failurePolicy *FailurePolicy
+	decisionPath  *DecisionPath
 }
 
 type QueryOption func(*queryOptions)
@@ -88,3 +219,8 @@ func (c *Client) Metadata() ast.FlatAnnotationsRefSet {
 	as := c.src.AnnotationSet()
 	return as.Flatten()
 }
+
+// Revision returns the revision of the policy data, such as the revision in the manifest of a bundle. It returns an empty string if the source has no revision.
+func (c *Client) Revision() string {
+	return c.src.Revision()
+}
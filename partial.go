@@ -0,0 +1,132 @@
+package opac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// PartialResult is a result of partial evaluation. The query is true for the unknowns if any of Queries is true, and it is always false if Queries is empty. Support is modules referred by Queries.
+type PartialResult struct {
+	Queries []ast.Body
+	Support []*ast.Module
+}
+
+// Partial partially evaluates the query with the input, treating the references in unknowns (such as `input.resource`) as unknown. The residual queries can be translated into other query languages, such as a WHERE clause of SQL. Local sources use partial evaluation of OPA, and Remote source uses the Compile API (/v1/compile) of OPA server.
+//
+// Example:
+//
+//	result, err := client.Partial(ctx, "data.authz.allow == true", input, []string{"input.resource"})
+//	for _, query := range result.Queries {
+//		fmt.Println(query)
+//	}
+func (c *Client) Partial(ctx context.Context, query string, input any, unknowns []string, options ...QueryOption) (*PartialResult, error) {
+	opt := queryOptions{}
+	for _, o := range options {
+		o(&opt)
+	}
+
+	ctx, span := c.startQuerySpan(ctx, "opac.Partial", query)
+
+	start := time.Now()
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	result, err := c.src.Partial(queryCtx, query, input, unknowns, opt)
+	err = limitCause(queryCtx, err)
+	c.cfg.metrics.ObserveQuery(sourceType(c.src), query, time.Since(start), errorCategory(err))
+	c.endQuerySpan(span, result != nil && len(result.Queries) > 0, PathEvaluated, err)
+
+	return result, err
+}
+
+// Partial implements Source.
+func (e *localEngine) Partial(ctx context.Context, query string, input any, unknowns []string, opt queryOptions) (*PartialResult, error) {
+	if err := checkEncodedSize(ErrMaxInputSize, e.cfg.maxInputSize, input); err != nil {
+		return nil, err
+	}
+
+	policies := e.policies.Load()
+	options := []func(*rego.Rego){
+		rego.Query(query),
+		rego.Compiler(policies.compiler),
+		rego.Store(policies.store),
+		rego.Unknowns(unknowns),
+	}
+	options = append(options, builtinOptions(e.cfg.builtins)...)
+	if v, ok := input.(ast.Value); ok {
+		options = append(options, rego.ParsedInput(v))
+	} else {
+		options = append(options, rego.Input(input))
+	}
+	if opt.printHook != nil {
+		options = append(options, rego.PrintHook(opt.printHook), rego.EnablePrintStatements(true))
+	}
+
+	e.cfg.logger.Debug("Partially evaluating query", "query", query, "unknowns", unknowns)
+	pq, err := rego.New(options...).Partial(ctx)
+	if err != nil {
+		var astErrs ast.Errors
+		if errors.As(err, &astErrs) {
+			e.cfg.capabilities.explainForbiddenCalls(err)
+			return nil, newCompileError("failed to prepare query", err)
+		}
+		return nil, newEvalError(err)
+	}
+
+	return &PartialResult{
+		Queries: pq.Queries,
+		Support: pq.Support,
+	}, nil
+}
+
+// Partial implements Source. It uses the Compile API (/v1/compile) of OPA server.
+func (r *remoteSource) Partial(ctx context.Context, query string, input any, unknowns []string, opt queryOptions) (*PartialResult, error) {
+	type httpInput struct {
+		Query    string   `json:"query"`
+		Input    any      `json:"input,omitempty"`
+		Unknowns []string `json:"unknowns"`
+	}
+
+	type httpOutput struct {
+		Result struct {
+			Queries []ast.Body    `json:"queries"`
+			Support []*ast.Module `json:"support"`
+		} `json:"result"`
+	}
+
+	value, err := inputValue(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEncodedSize(ErrMaxInputSize, r.maxInputSize, value); err != nil {
+		return nil, err
+	}
+
+	inputBody, err := json.Marshal(httpInput{Query: query, Input: value, Unknowns: unknowns})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	body, err := r.send(ctx, r.url.JoinPath("compile").String(), inputBody)
+	if err != nil {
+		return nil, newRemoteError(err)
+	}
+	if err := checkSize(ErrMaxOutputSize, r.maxOutputSize, len(body)); err != nil {
+		return nil, err
+	}
+
+	var outputData httpOutput
+	if err := json.Unmarshal(body, &outputData); err != nil {
+		return nil, newDecodeError(fmt.Errorf("failed to unmarshal response body: %w", err))
+	}
+
+	return &PartialResult{
+		Queries: outputData.Result.Queries,
+		Support: outputData.Result.Support,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package opac_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+const partialPolicy = `package authz
+
+allow if { input.subject.role == "admin" }
+allow if { input.resource.owner == input.subject.name }
+allow if {
+	input.resource.public
+	not input.resource.archived
+}
+`
+
+func TestPartial(t *testing.T) {
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": partialPolicy}))).NoError(t)
+	ctx := context.Background()
+	unknowns := []string{"input.resource"}
+
+	queryStrings := func(result *opac.PartialResult) []string {
+		var queries []string
+		for _, q := range result.Queries {
+			queries = append(queries, q.String())
+		}
+		return queries
+	}
+
+	t.Run("residual queries", func(t *testing.T) {
+		input := map[string]any{"subject": map[string]any{"name": "bob", "role": "user"}}
+		result := gt.R1(client.Partial(ctx, "data.authz.allow == true", input, unknowns)).NoError(t)
+		gt.Equal(t, queryStrings(result), []string{
+			`"bob" = input.resource.owner`,
+			`input.resource.public; not input.resource.archived`,
+		})
+	})
+
+	t.Run("unconditionally true", func(t *testing.T) {
+		input := map[string]any{"subject": map[string]any{"name": "alice", "role": "admin"}}
+		result := gt.R1(client.Partial(ctx, "data.authz.allow == true", input, unknowns)).NoError(t)
+		// An empty query is always true
+		gt.A(t, queryStrings(result)).Have("")
+	})
+
+	t.Run("parsed input", func(t *testing.T) {
+		input := ast.MustParseTerm(`{"subject": {"name": "bob", "role": "user"}}`).Value
+		result := gt.R1(client.Partial(ctx, "data.authz.allow == true", input, unknowns)).NoError(t)
+		gt.A(t, result.Queries).Length(2)
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := client.Partial(ctx, "data.authz.allow ==", nil, unknowns)
+		var compileErr *opac.CompileError
+		gt.True(t, errors.As(err, &compileErr))
+	})
+}
+
+func TestRemotePartial(t *testing.T) {
+	queries := []ast.Body{ast.MustParseBody(`"bob" = input.resource.owner`)}
+	respBody := gt.R1(json.Marshal(map[string]any{
+		"result": map[string]any{"queries": queries},
+	})).NoError(t)
+
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			gt.Equal(t, req.URL.String(), "https://example.com/v1/compile")
+
+			var body struct {
+				Query    string         `json:"query"`
+				Input    map[string]any `json:"input"`
+				Unknowns []string       `json:"unknowns"`
+			}
+			gt.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			gt.Equal(t, body.Query, "data.authz.allow == true")
+			gt.Equal(t, body.Input, map[string]any{"subject": map[string]any{"name": "bob"}})
+			gt.Equal(t, body.Unknowns, []string{"input.resource"})
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(string(respBody))),
+			}, nil
+		},
+	}
+	client := gt.R1(opac.New(opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)))).NoError(t)
+
+	input := map[string]any{"subject": map[string]any{"name": "bob"}}
+	result := gt.R1(client.Partial(context.Background(), "data.authz.allow == true", input, []string{"input.resource"})).NoError(t)
+	gt.A(t, result.Queries).Length(1)
+	gt.True(t, result.Queries[0].Equal(queries[0]))
+}
@@ -0,0 +1,109 @@
+package opac
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type prometheusMetrics struct {
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+	remoteResponses *prometheus.CounterVec
+	reloads         *prometheus.CounterVec
+	queryCache      *prometheus.CounterVec
+}
+
+// NewPrometheusMetrics creates Metrics for Prometheus and registers collectors to the registerer. The following metrics are exported:
+//
+//   - opac_query_duration_seconds: histogram of query latency by query and source. The query label is the query for a path of data such as "data.authz.allow", and "adhoc" for other queries such as "x := data.items[i]" to keep the number of label values bounded.
+//   - opac_query_errors_total: counter of query errors by source and category
+//   - opac_remote_responses_total: counter of responses from OPA server by status code
+//   - opac_reloads_total: counter of reloading policies by outcome (success or failure)
+//   - opac_query_cache_total: counter of lookups of the prepared query cache by result (hit or miss)
+func NewPrometheusMetrics(registerer prometheus.Registerer) (Metrics, error) {
+	m := &prometheusMetrics{
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "opac",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of policy queries.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"query", "source"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "opac",
+			Name:      "query_errors_total",
+			Help:      "Number of failed policy queries.",
+		}, []string{"source", "category"}),
+		remoteResponses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "opac",
+			Name:      "remote_responses_total",
+			Help:      "Number of responses from OPA server.",
+		}, []string{"code"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "opac",
+			Name:      "reloads_total",
+			Help:      "Number of reloading policies in background.",
+		}, []string{"outcome"}),
+		queryCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "opac",
+			Name:      "query_cache_total",
+			Help:      "Number of lookups of the prepared query cache.",
+		}, []string{"result"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.queryDuration, m.queryErrors, m.remoteResponses, m.reloads, m.queryCache} {
+		if err := registerer.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// adhocQueryLabel is the query label for queries other than a path of data.
+const adhocQueryLabel = "adhoc"
+
+// dataPathQuery matches a query of a path of data, such as "data.authz.allow".
+var dataPathQuery = regexp.MustCompile(`^data(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// queryLabel returns the query label of the query.
+func queryLabel(query string) string {
+	if dataPathQuery.MatchString(query) {
+		return query
+	}
+	return adhocQueryLabel
+}
+
+// ObserveQuery implements Metrics.
+func (m *prometheusMetrics) ObserveQuery(source, query string, latency time.Duration, category ErrorCategory) {
+	m.queryDuration.WithLabelValues(queryLabel(query), source).Observe(latency.Seconds())
+	if category != ErrorCategoryNone {
+		m.queryErrors.WithLabelValues(source, string(category)).Inc()
+	}
+}
+
+// ObserveRemoteStatus implements Metrics.
+func (m *prometheusMetrics) ObserveRemoteStatus(code int) {
+	m.remoteResponses.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+// ObserveReload implements Metrics.
+func (m *prometheusMetrics) ObserveReload(success bool) {
+	outcome := "success"
+	if !success {
+		outcome = "failure"
+	}
+	m.reloads.WithLabelValues(outcome).Inc()
+}
+
+// ObserveQueryCache implements Metrics.
+func (m *prometheusMetrics) ObserveQueryCache(hit bool) {
+	result := "hit"
+	if !hit {
+		result = "miss"
+	}
+	m.queryCache.WithLabelValues(result).Inc()
+}
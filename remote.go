@@ -9,10 +9,11 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
-	"path"
 	"strings"
+	"time"
 
 	"github.com/open-policy-agent/opa/ast"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type HTTPClient interface {
@@ -24,15 +25,30 @@ type RemoteOption func(*remoteSource)
 func WithHTTPClient(client HTTPClient) RemoteOption {
 	return func(r *remoteSource) {
 		r.httpClient = client
+		r.customHTTPClient = true
 	}
 }
 
 type remoteSource struct {
-	httpClient HTTPClient
-	logger     *slog.Logger
-	rawURL     string
-	url        *url.URL
-	options    []RemoteOption
+	httpClient       HTTPClient
+	customHTTPClient bool
+	logger           *slog.Logger
+	masker           *masker
+	metrics          Metrics
+	maxInputSize     int64
+	maxOutputSize    int64
+	propagator       propagation.TextMapPropagator
+	rawURL           string
+	url              *url.URL
+	options          []RemoteOption
+
+	retry   *retryPolicy
+	breaker *circuitBreaker
+
+	tokenProvider func(ctx context.Context) (string, error)
+	certFile      string
+	keyFile       string
+	caFile        string
 }
 
 // AnnotationSet implements Source.
@@ -40,6 +56,16 @@ func (r *remoteSource) AnnotationSet() *ast.AnnotationSet {
 	return &ast.AnnotationSet{}
 }
 
+// Revision implements Source.
+func (r *remoteSource) Revision() string {
+	return ""
+}
+
+// Warnings implements Source. Compiler warnings of OPA server are not available.
+func (r *remoteSource) Warnings() []*RegoError {
+	return nil
+}
+
 // Configure implements Source.
 func (r *remoteSource) Configure(cfg *config) error {
 	tgtURL, err := url.Parse(r.rawURL)
@@ -51,8 +77,20 @@ func (r *remoteSource) Configure(cfg *config) error {
 		opt(r)
 	}
 
+	if err := r.configureTLS(); err != nil {
+		return err
+	}
+
 	r.logger = cfg.logger
+	r.masker = cfg.mask
+	r.metrics = cfg.metrics
+	r.maxInputSize = cfg.maxInputSize
+	r.maxOutputSize = cfg.maxOutputSize
+	r.propagator = cfg.propagator
 	r.url = tgtURL
+	if r.breaker != nil {
+		r.breaker.logger = cfg.logger
+	}
 
 	return nil
 }
@@ -67,59 +105,182 @@ func (r *remoteSource) Query(ctx context.Context, query string, input any, outpu
 		Result any `json:"result"`
 	}
 
-	inputData := httpInput{Input: input}
+	value, err := inputValue(input)
+	if err != nil {
+		return err
+	}
+	if err := checkEncodedSize(ErrMaxInputSize, r.maxInputSize, value); err != nil {
+		return err
+	}
 
-	inputBody, err := json.Marshal(inputData)
+	inputBody, err := json.Marshal(httpInput{Input: value})
 	if err != nil {
 		return fmt.Errorf("failed to marshal input: %w", err)
 	}
 
-	reqURL := r.url
-	queryPath := strings.ReplaceAll(query, ".", "/")
-	reqURL.Path = path.Join(reqURL.Path, queryPath)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), bytes.NewReader(inputBody))
+	body, err := r.send(ctx, r.dataURL(query), inputBody)
 	if err != nil {
-		return fmt.Errorf("failed to create request to OPA server: %w", err)
+		return newRemoteError(err)
+	}
+	if err := checkSize(ErrMaxOutputSize, r.maxOutputSize, len(body)); err != nil {
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	var outputData httpOutput
+	if err := json.Unmarshal(body, &outputData); err != nil {
+		return newDecodeError(fmt.Errorf("failed to unmarshal response body: %w", err))
+	}
 
-	r.logger.Debug("Sending request to OPA server", "url", req.URL.String(), "body", string(inputBody))
-	resp, err := r.httpClient.Do(req)
+	if outputData.Result == nil {
+		return ErrNoEvalResult
+	}
+
+	return newDecodeError(decodeResult(outputData.Result, output))
+}
+
+// QueryResultSet implements Source. It evaluates the ad-hoc query with Query API (/v1/query) of OPA server. The server returns only bindings of variables, so Expressions of each result is empty.
+func (r *remoteSource) QueryResultSet(ctx context.Context, query string, input any, opt queryOptions) (ResultSet, error) {
+	type httpInput struct {
+		Query string `json:"query"`
+		Input any    `json:"input,omitempty"`
+	}
+
+	type httpOutput struct {
+		Result []map[string]any `json:"result"`
+	}
+
+	value, err := inputValue(input)
 	if err != nil {
-		return fmt.Errorf("failed to send request to OPA server: %w", err)
+		return nil, err
+	}
+	if err := checkEncodedSize(ErrMaxInputSize, r.maxInputSize, value); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, readErr := io.ReadAll(resp.Body)
-	r.logger.Debug("Received response from OPA server", "status", resp.StatusCode, "body", string(body), "headers", resp.Header)
+	inputBody, err := json.Marshal(httpInput{Query: query, Input: value})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code from OPA server: %d msg='%s'", resp.StatusCode, string(body))
+	body, err := r.send(ctx, r.url.JoinPath("query").String(), inputBody)
+	if err != nil {
+		return nil, newRemoteError(err)
 	}
-	if readErr != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+	if err := checkSize(ErrMaxOutputSize, r.maxOutputSize, len(body)); err != nil {
+		return nil, err
 	}
 
 	var outputData httpOutput
 	if err := json.Unmarshal(body, &outputData); err != nil {
-		return fmt.Errorf("failed to unmarshal response body: %w", err)
+		return nil, newDecodeError(fmt.Errorf("failed to unmarshal response body: %w", err))
 	}
 
-	if outputData.Result == nil {
-		return ErrNoEvalResult
+	results := make(ResultSet, 0, len(outputData.Result))
+	for _, bindings := range outputData.Result {
+		results = append(results, Result{Bindings: bindings})
 	}
 
-	raw, err := json.Marshal(outputData.Result)
+	return results, nil
+}
+
+// send sends POST request to OPA server and returns the response body of 200 status. The request is retried and guarded by the circuit breaker if they are configured.
+func (r *remoteSource) send(ctx context.Context, reqURL string, reqBody []byte) ([]byte, error) {
+	authorization, err := r.authorization(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to marshal result: %w", err)
+		return nil, err
 	}
-	if err := json.Unmarshal(raw, output); err != nil {
-		return fmt.Errorf("failed to unmarshal result: %w", err)
+
+	attempts := r.retry.attempts()
+	for attempt := 1; ; attempt++ {
+		if !r.breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := r.sendOnce(ctx, reqURL, reqBody, authorization)
+		if ctx.Err() != nil {
+			r.breaker.cancel()
+			if err == nil {
+				err = ctx.Err()
+			}
+			return nil, err
+		}
+
+		retryable := err != nil || isRetryableStatus(resp.status)
+		r.breaker.record(retryable)
+
+		if err == nil && resp.status == http.StatusOK {
+			return resp.body, nil
+		}
+		if err == nil {
+			err = newRemoteStatusError(resp.status, resp.body)
+		}
+		if !retryable || attempt >= attempts {
+			return nil, err
+		}
+
+		var retryAfter time.Duration
+		if resp != nil {
+			retryAfter = parseRetryAfter(resp.header.Get("Retry-After"), time.Now())
+		}
+		delay := r.retry.delay(attempt, retryAfter)
+		r.logger.Debug("Retrying request to OPA server", "attempt", attempt, "delay", delay, "error", err)
+		if !sleepContext(ctx, delay) {
+			return nil, err
+		}
 	}
+}
 
-	return nil
+type remoteResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// sendOnce sends POST request to OPA server once. It returns an error only if the request could not be done or the response body could not be read.
+func (r *remoteSource) sendOnce(ctx context.Context, reqURL string, reqBody []byte, authorization string) (*remoteResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request to OPA server: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	r.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// Bodies are masked only when they are logged, because masking parses the JSON body
+	debug := r.logger.Enabled(ctx, slog.LevelDebug)
+	if debug {
+		r.logger.Debug("Sending request to OPA server", "url", req.URL.String(), "body", r.masker.maskJSON(reqBody))
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to OPA server: %w", err)
+	}
+	defer resp.Body.Close()
+	r.metrics.ObserveRemoteStatus(resp.StatusCode)
+
+	body, readErr := io.ReadAll(resp.Body)
+	if debug {
+		r.logger.Debug("Received response from OPA server", "status", resp.StatusCode, "body", r.masker.maskJSON(body), "headers", resp.Header)
+	}
+
+	if readErr != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("failed to read response body: %w", readErr)
+	}
+
+	return &remoteResponse{
+		status: resp.StatusCode,
+		header: resp.Header,
+		body:   body,
+	}, nil
+}
+
+// dataURL returns the URL of Data API for the query. The base URL is never modified after Configure, so that it can be called concurrently.
+func (r *remoteSource) dataURL(query string) string {
+	queryPath := strings.ReplaceAll(query, ".", "/")
+	return r.url.JoinPath(queryPath).String()
 }
 
 var _ Source = (*remoteSource)(nil)
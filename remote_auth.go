@@ -0,0 +1,144 @@
+package opac
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// WithBearerToken sets a static bearer token sent in Authorization header to OPA server, for OPA running with --authentication=token.
+func WithBearerToken(token string) RemoteOption {
+	return func(r *remoteSource) {
+		r.tokenProvider = func(ctx context.Context) (string, error) {
+			return token, nil
+		}
+	}
+}
+
+// WithTokenProvider sets a function that provides a bearer token for each request to OPA server. It can be used for rotating tokens. The function must be safe for concurrent use.
+func WithTokenProvider(provider func(ctx context.Context) (string, error)) RemoteOption {
+	return func(r *remoteSource) {
+		r.tokenProvider = provider
+	}
+}
+
+// WithTokenFile sets a file path to read a bearer token for requests to OPA server. The file is read again when it is changed. Leading and trailing white spaces of the file content are trimmed.
+func WithTokenFile(path string) RemoteOption {
+	return func(r *remoteSource) {
+		tf := &tokenFile{path: path}
+		r.tokenProvider = tf.token
+	}
+}
+
+// WithClientCertificate sets a client certificate and a private key in PEM files for mutual TLS authentication with OPA server. It can not be used with WithHTTPClient.
+func WithClientCertificate(certFile, keyFile string) RemoteOption {
+	return func(r *remoteSource) {
+		r.certFile = certFile
+		r.keyFile = keyFile
+	}
+}
+
+// WithCACertificate sets a PEM file of CA certificates to verify the certificate of OPA server instead of the system CA certificates. It can not be used with WithHTTPClient.
+func WithCACertificate(caFile string) RemoteOption {
+	return func(r *remoteSource) {
+		r.caFile = caFile
+	}
+}
+
+// ErrTLSWithHTTPClient is returned when TLS options are used with WithHTTPClient. TLS settings should be configured in the custom HTTP client in that case.
+var ErrTLSWithHTTPClient = errors.New("WithClientCertificate and WithCACertificate can not be used with WithHTTPClient")
+
+// configureTLS creates HTTP client with TLS settings if TLS options are set.
+func (r *remoteSource) configureTLS() error {
+	if r.certFile == "" && r.caFile == "" {
+		return nil
+	}
+	if r.customHTTPClient {
+		return ErrTLSWithHTTPClient
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if r.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if r.caFile != "" {
+		raw, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return fmt.Errorf("no valid CA certificate in %s", r.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	r.httpClient = &http.Client{Transport: transport}
+
+	return nil
+}
+
+// authorization returns value of Authorization header. It returns an empty string if no token provider is configured.
+func (r *remoteSource) authorization(ctx context.Context) (string, error) {
+	if r.tokenProvider == nil {
+		return "", nil
+	}
+
+	token, err := r.tokenProvider(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get bearer token: %w", err)
+	}
+	return "Bearer " + token, nil
+}
+
+// tokenFile reads a bearer token from the file and caches it until the file is changed.
+type tokenFile struct {
+	path   string
+	mutex  sync.Mutex
+	stamp  fileStamp
+	cached string
+}
+
+func (f *tokenFile) token(ctx context.Context) (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.cached != "" && stamp == f.stamp {
+		return f.cached, nil
+	}
+
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("token file is empty: %s", f.path)
+	}
+
+	f.stamp = stamp
+	f.cached = token
+	return token, nil
+}
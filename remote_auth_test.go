@@ -0,0 +1,223 @@
+package opac_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+func TestRemoteBearerToken(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenPath, "file-token-1\n")
+
+	type testCase struct {
+		option  opac.RemoteOption
+		expect  []string
+		queries int
+		update  func(i int)
+		isErr   bool
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			var headers []string
+			mock := &httpMock{
+				do: func(req *http.Request) (*http.Response, error) {
+					headers = append(headers, req.Header.Get("Authorization"))
+					return &http.Response{
+						StatusCode: 200,
+						Body:       io.NopCloser(strings.NewReader(`{"result": {"allow": true}}`)),
+					}, nil
+				},
+			}
+			client := gt.R1(opac.New(
+				opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock), tc.option),
+			)).NoError(t)
+
+			for i := 0; i < tc.queries; i++ {
+				if tc.update != nil {
+					tc.update(i)
+				}
+				var output any
+				err := client.Query(context.Background(), "data.system.authz", nil, &output)
+				if tc.isErr {
+					gt.Error(t, err)
+					return
+				}
+				gt.NoError(t, err)
+			}
+			gt.Equal(t, headers, tc.expect)
+		}
+	}
+
+	t.Run("static token", doTest(testCase{
+		option:  opac.WithBearerToken("static-token"),
+		queries: 2,
+		expect:  []string{"Bearer static-token", "Bearer static-token"},
+	}))
+
+	tokens := []string{"token-a", "token-b"}
+	t.Run("token provider", doTest(testCase{
+		option: opac.WithTokenProvider(func(ctx context.Context) (string, error) {
+			token := tokens[0]
+			tokens = tokens[1:]
+			return token, nil
+		}),
+		queries: 2,
+		expect:  []string{"Bearer token-a", "Bearer token-b"},
+	}))
+
+	t.Run("token provider error", doTest(testCase{
+		option: opac.WithTokenProvider(func(ctx context.Context) (string, error) {
+			return "", errors.New("expired")
+		}),
+		queries: 1,
+		isErr:   true,
+	}))
+
+	t.Run("token file", doTest(testCase{
+		option:  opac.WithTokenFile(tokenPath),
+		queries: 3,
+		update: func(i int) {
+			if i == 2 {
+				writeFile(t, tokenPath, "file-token-2-rotated\n")
+			}
+		},
+		expect: []string{"Bearer file-token-1", "Bearer file-token-1", "Bearer file-token-2-rotated"},
+	}))
+
+	t.Run("token file not found", doTest(testCase{
+		option:  opac.WithTokenFile(filepath.Join(t.TempDir(), "not_found")),
+		queries: 1,
+		isErr:   true,
+	}))
+}
+
+func writeCertificate(t *testing.T, dir, name string, cert *x509.Certificate, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (*x509.Certificate, string, string) {
+	der := gt.R1(x509.CreateCertificate(rand.Reader, cert, parent, &key.PublicKey, parentKey)).NoError(t)
+	parsed := gt.R1(x509.ParseCertificate(der)).NoError(t)
+	certPath := filepath.Join(dir, name+".crt")
+	gt.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+
+	keyDER := gt.R1(x509.MarshalECPrivateKey(key)).NoError(t)
+	keyPath := filepath.Join(dir, name+".key")
+	gt.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return parsed, certPath, keyPath
+}
+
+func TestRemoteMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	// client certificate signed by a test CA
+	caKey := gt.R1(ecdsa.GenerateKey(elliptic.P256(), rand.Reader)).NoError(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caCert, _, _ := writeCertificate(t, dir, "ca", caTemplate, caTemplate, caKey, caKey)
+
+	clientKey := gt.R1(ecdsa.GenerateKey(elliptic.P256(), rand.Reader)).NoError(t)
+	clientCert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "opac client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	_, certFile, keyFile := writeCertificate(t, dir, "client", clientCert, caCert, clientKey, caKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gt.A(t, r.TLS.PeerCertificates).Length(1)
+		gt.Equal(t, r.TLS.PeerCertificates[0].Subject.CommonName, "opac client")
+		_, _ = w.Write([]byte(`{"result": {"allow": true}}`))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	// CA file to verify the server certificate of httptest
+	serverCAFile := filepath.Join(dir, "server-ca.crt")
+	gt.NoError(t, os.WriteFile(serverCAFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0600))
+
+	t.Run("success", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Remote(server.URL+"/v1",
+			opac.WithClientCertificate(certFile, keyFile),
+			opac.WithCACertificate(serverCAFile),
+		))).NoError(t)
+
+		var output struct {
+			Allow bool `json:"allow"`
+		}
+		gt.NoError(t, client.Query(context.Background(), "data.system.authz", nil, &output))
+		gt.True(t, output.Allow)
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Remote(server.URL+"/v1",
+			opac.WithCACertificate(serverCAFile),
+		))).NoError(t)
+
+		var output any
+		gt.Error(t, client.Query(context.Background(), "data.system.authz", nil, &output))
+	})
+
+	t.Run("unknown server CA", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Remote(server.URL+"/v1",
+			opac.WithClientCertificate(certFile, keyFile),
+		))).NoError(t)
+
+		var output any
+		gt.Error(t, client.Query(context.Background(), "data.system.authz", nil, &output))
+	})
+
+	t.Run("invalid key file", func(t *testing.T) {
+		_, err := opac.New(opac.Remote(server.URL+"/v1",
+			opac.WithClientCertificate(certFile, serverCAFile),
+		))
+		gt.Error(t, err)
+	})
+
+	t.Run("with custom HTTP client", func(t *testing.T) {
+		_, err := opac.New(opac.Remote(server.URL+"/v1",
+			opac.WithHTTPClient(http.DefaultClient),
+			opac.WithCACertificate(serverCAFile),
+		))
+		gt.True(t, errors.Is(err, opac.ErrTLSWithHTTPClient))
+	})
+}
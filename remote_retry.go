@@ -0,0 +1,223 @@
+package opac
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithRetry enables retries of requests to OPA server. A request is retried up to maxAttempts times in total on network errors, 5xx status and 429 status. The delay before each retry is exponential backoff from baseDelay with full jitter, capped by maxDelay. Retry-After header of the response is honored if exists, and it is also capped by maxDelay if maxDelay is positive. Retrying stops if the next attempt would exceed the deadline of the context.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) RemoteOption {
+	return func(r *remoteSource) {
+		r.retry = &retryPolicy{
+			maxAttempts: maxAttempts,
+			baseDelay:   baseDelay,
+			maxDelay:    maxDelay,
+		}
+	}
+}
+
+// WithCircuitBreaker enables a circuit breaker for requests to OPA server. After failureThreshold consecutive failures (network errors, 5xx status and 429 status), the circuit opens and queries fail fast with ErrCircuitOpen for openDuration. Then one trial request is allowed, and the circuit closes if it succeeds or opens again if it fails. State changes are logged through the logger of the client.
+func WithCircuitBreaker(failureThreshold int, openDuration time.Duration) RemoteOption {
+	return func(r *remoteSource) {
+		r.breaker = &circuitBreaker{
+			threshold:    failureThreshold,
+			openDuration: openDuration,
+			now:          time.Now,
+		}
+	}
+}
+
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// attempts returns number of attempts. It is at least 1.
+func (p *retryPolicy) attempts() int {
+	if p == nil || p.maxAttempts < 1 {
+		return 1
+	}
+	return p.maxAttempts
+}
+
+// delay returns the delay before the next attempt. The retry is 1 for the first retry. Retry-After is capped by maxDelay so that a long value from a proxy does not block the query.
+func (p *retryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if p.maxDelay > 0 && retryAfter > p.maxDelay {
+			return p.maxDelay
+		}
+		return retryAfter
+	}
+
+	backoff := p.baseDelay << (retry - 1)
+	if backoff <= 0 || (p.maxDelay > 0 && backoff > p.maxDelay) {
+		backoff = p.maxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	// #nosec G404 jitter does not require cryptographically secure random
+	return rand.N(backoff + 1)
+}
+
+// isRetryableStatus returns true for status code that indicates the server is unhealthy or busy.
+func isRetryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// parseRetryAfter parses Retry-After header in seconds or HTTP date. It returns zero if the header is not available.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(value); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// sleepContext waits for the duration. It returns false if the context is done or the deadline of the context comes before the duration.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops requests while the server is unhealthy.
+type circuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+	now          func() time.Time
+	logger       *slog.Logger
+
+	mutex    sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	trialing bool
+}
+
+// allow returns true if a request can be sent.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.setState(circuitHalfOpen)
+		b.trialing = true
+		return true
+
+	case circuitHalfOpen:
+		// only one trial request is allowed in half-open state
+		if b.trialing {
+			return false
+		}
+		b.trialing = true
+		return true
+
+	default:
+		return true
+	}
+}
+
+// record records the result of the request.
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.trialing = false
+	}
+
+	if !failed {
+		b.failures = 0
+		if b.state != circuitClosed {
+			b.setState(circuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.threshold) {
+		b.openedAt = b.now()
+		b.setState(circuitOpen)
+	}
+}
+
+// cancel releases the trial request in half-open state without recording the result, for the request canceled by the caller.
+func (b *circuitBreaker) cancel() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.trialing = false
+	}
+}
+
+func (b *circuitBreaker) setState(state circuitState) {
+	prev := b.state
+	b.state = state
+
+	switch state {
+	case circuitOpen:
+		b.logger.Warn("Circuit breaker for OPA server is open", "from", prev.String(), "failures", b.failures, "open duration", b.openDuration)
+	default:
+		b.logger.Info("Circuit breaker for OPA server changed state", "from", prev.String(), "to", state.String())
+	}
+}
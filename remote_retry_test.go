@@ -0,0 +1,206 @@
+package opac_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+func newResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestRemoteRetry(t *testing.T) {
+	type testCase struct {
+		responses []func() (*http.Response, error)
+		maxDelay  time.Duration
+		timeout   time.Duration
+		within    time.Duration
+		calls     int
+		isErr     bool
+	}
+
+	okResp := func() (*http.Response, error) {
+		return newResponse(http.StatusOK, `{"result": {"allow": true}}`), nil
+	}
+	statusResp := func(status int) func() (*http.Response, error) {
+		return func() (*http.Response, error) {
+			return newResponse(status, `{"code": "internal_error"}`), nil
+		}
+	}
+	netErr := func() (*http.Response, error) {
+		return nil, errors.New("connection reset by peer")
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			var calls int
+			mock := &httpMock{
+				do: func(req *http.Request) (*http.Response, error) {
+					body := gt.R1(io.ReadAll(req.Body)).NoError(t)
+					gt.Equal(t, string(body), `{"input":{"user":"admin"}}`)
+
+					resp := tc.responses[calls]
+					calls++
+					return resp()
+				},
+			}
+			maxDelay := tc.maxDelay
+			if maxDelay == 0 {
+				maxDelay = 10 * time.Millisecond
+			}
+			client := gt.R1(opac.New(opac.Remote("https://example.com/v1",
+				opac.WithHTTPClient(mock),
+				opac.WithRetry(3, time.Millisecond, maxDelay),
+			))).NoError(t)
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			var output struct {
+				Allow bool `json:"allow"`
+			}
+			start := time.Now()
+			err := client.Query(ctx, "data.system.authz", map[string]any{"user": "admin"}, &output)
+			if tc.within > 0 {
+				gt.True(t, time.Since(start) < tc.within)
+			}
+			gt.Equal(t, calls, tc.calls)
+			if tc.isErr {
+				gt.Error(t, err)
+				return
+			}
+			gt.NoError(t, err)
+			gt.True(t, output.Allow)
+		}
+	}
+
+	t.Run("no retry on success", doTest(testCase{
+		responses: []func() (*http.Response, error){okResp},
+		calls:     1,
+	}))
+
+	t.Run("retry on 502", doTest(testCase{
+		responses: []func() (*http.Response, error){statusResp(http.StatusBadGateway), okResp},
+		calls:     2,
+	}))
+
+	t.Run("retry on network error", doTest(testCase{
+		responses: []func() (*http.Response, error){netErr, netErr, okResp},
+		calls:     3,
+	}))
+
+	t.Run("retry on 429", doTest(testCase{
+		responses: []func() (*http.Response, error){statusResp(http.StatusTooManyRequests), okResp},
+		calls:     2,
+	}))
+
+	t.Run("no retry on 400", doTest(testCase{
+		responses: []func() (*http.Response, error){statusResp(http.StatusBadRequest)},
+		calls:     1,
+		isErr:     true,
+	}))
+
+	t.Run("give up after max attempts", doTest(testCase{
+		responses: []func() (*http.Response, error){netErr, netErr, netErr},
+		calls:     3,
+		isErr:     true,
+	}))
+
+	t.Run("Retry-After exceeds context deadline", doTest(testCase{
+		responses: []func() (*http.Response, error){
+			func() (*http.Response, error) {
+				resp := newResponse(http.StatusServiceUnavailable, "")
+				resp.Header.Set("Retry-After", "10")
+				return resp, nil
+			},
+		},
+		maxDelay: time.Minute,
+		timeout:  time.Second,
+		calls:    1,
+		isErr:    true,
+	}))
+
+	t.Run("Retry-After is capped by max delay", doTest(testCase{
+		responses: []func() (*http.Response, error){
+			func() (*http.Response, error) {
+				resp := newResponse(http.StatusServiceUnavailable, "")
+				resp.Header.Set("Retry-After", "3600")
+				return resp, nil
+			},
+			okResp,
+		},
+		within: time.Second,
+		calls:  2,
+	}))
+}
+
+func TestRemoteCircuitBreaker(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			if healthy.Load() {
+				return newResponse(http.StatusOK, `{"result": {"allow": true}}`), nil
+			}
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	client := gt.R1(opac.New(opac.Remote("https://example.com/v1",
+		opac.WithHTTPClient(mock),
+		opac.WithCircuitBreaker(2, 50*time.Millisecond),
+	), opac.WithLogger(logger))).NoError(t)
+
+	ctx := context.Background()
+	query := func() error {
+		var output any
+		return client.Query(ctx, "data.system.authz", nil, &output)
+	}
+
+	// consecutive failures open the circuit
+	gt.Error(t, query())
+	gt.Error(t, query())
+	gt.Equal(t, calls.Load(), 2)
+	gt.True(t, strings.Contains(logs.String(), "Circuit breaker for OPA server is open"))
+
+	// fail fast while the circuit is open
+	gt.True(t, errors.Is(query(), opac.ErrCircuitOpen))
+	gt.Equal(t, calls.Load(), 2)
+
+	// trial request fails and the circuit opens again
+	time.Sleep(60 * time.Millisecond)
+	gt.False(t, errors.Is(query(), opac.ErrCircuitOpen))
+	gt.Equal(t, calls.Load(), 3)
+	gt.True(t, errors.Is(query(), opac.ErrCircuitOpen))
+
+	// trial request succeeds and the circuit closes
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	gt.NoError(t, query())
+	gt.NoError(t, query())
+	gt.Equal(t, calls.Load(), 5)
+	gt.True(t, strings.Contains(logs.String(), "to=closed"))
+}
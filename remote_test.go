@@ -1,14 +1,17 @@
 package opac_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -169,6 +172,71 @@ func TestRemote(t *testing.T) {
 	}))
 }
 
+func TestRemoteQueryPath(t *testing.T) {
+	var paths []string
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			paths = append(paths, req.URL.Path)
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(strings.NewReader(`{"result": {"allow": true}}`)),
+			}, nil
+		},
+	}
+	client := gt.R1(opac.New(
+		opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)),
+	)).NoError(t)
+
+	ctx := context.Background()
+	var output any
+	gt.NoError(t, client.Query(ctx, "data.system.authz", nil, &output))
+	gt.NoError(t, client.Query(ctx, "data.system.authz", nil, &output))
+	gt.NoError(t, client.Query(ctx, "data.color", nil, &output))
+	gt.Equal(t, paths, []string{
+		"/v1/data/system/authz",
+		"/v1/data/system/authz",
+		"/v1/data/color",
+	})
+}
+
+func TestRemoteConcurrentQuery(t *testing.T) {
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			// respond the query path to check the request is sent to the expected URL
+			body, err := json.Marshal(map[string]any{
+				"result": map[string]any{"path": req.URL.Path},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(bytes.NewReader(body)),
+			}, nil
+		},
+	}
+	client := gt.R1(opac.New(
+		opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)),
+	)).NoError(t)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pkg := fmt.Sprintf("pkg%d", i%10)
+
+			var output struct {
+				Path string `json:"path"`
+			}
+			gt.NoError(t, client.Query(ctx, "data."+pkg+".allow", nil, &output))
+			gt.Equal(t, output.Path, "/v1/data/"+pkg+"/allow")
+		}(i)
+	}
+	wg.Wait()
+}
+
 func loadEnvVar(t *testing.T, key string) string {
 	v, ok := os.LookupEnv(key)
 	if !ok {
@@ -0,0 +1,61 @@
+package opac
+
+import (
+	"context"
+	"time"
+)
+
+// ResultSet is a set of all results of a query. It is empty if the query is undefined.
+type ResultSet []Result
+
+// Result is a single result of a query. A query has more than one result when its variables are bound to different values, such as `data.x.items[i]`.
+type Result struct {
+	// Expressions is a list of values of the expressions in the query. It is empty for Remote source because the OPA server returns only bindings.
+	Expressions []*Expression `json:"expressions,omitempty"`
+
+	// Bindings is a map of variable names to the bound values. Generated variables are not included.
+	Bindings map[string]any `json:"bindings,omitempty"`
+}
+
+// Expression is a value of an expression in a query.
+type Expression struct {
+	// Value is the evaluated value. It is decoded in the same manner as JSON decoding into `any`.
+	Value any `json:"value"`
+
+	// Text is the original text of the expression.
+	Text string `json:"text"`
+}
+
+// QueryResultSet evaluates the query with the provided input and returns all results with bindings of variables and values of all expressions. Unlike Query, it does not return ErrNoEvalResult for an undefined query but an empty ResultSet, and the failure policy is not applied. Remote source uses the Query API (/v1/query) of the OPA server, and only bindings are available.
+//
+// Example:
+//
+//	rs, err := client.QueryResultSet(ctx, "x := data.items[i]", input)
+//	for _, r := range rs {
+//		fmt.Println(r.Bindings["i"], r.Bindings["x"])
+//	}
+func (c *Client) QueryResultSet(ctx context.Context, query string, input any, options ...QueryOption) (ResultSet, error) {
+	opt := queryOptions{}
+	for _, o := range options {
+		o(&opt)
+	}
+
+	ctx, span := c.startQuerySpan(ctx, "opac.QueryResultSet", query)
+
+	start := time.Now()
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	rs, err := c.src.QueryResultSet(queryCtx, query, input, opt)
+	err = limitCause(queryCtx, err)
+	c.cfg.metrics.ObserveQuery(sourceType(c.src), query, time.Since(start), errorCategory(err))
+	c.endQuerySpan(span, len(rs) > 0, PathEvaluated, err)
+
+	if c.decisionLogger != nil {
+		var result any
+		if err == nil {
+			result = rs
+		}
+		c.logDecision(c.src, start, query, input, result, PathEvaluated, err)
+	}
+	return rs, err
+}
@@ -0,0 +1,79 @@
+package opac_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+func TestQueryResultSet(t *testing.T) {
+	policy := `package items
+
+list := ["blue", "white", "red"]
+limit := 2
+`
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}))).NoError(t)
+	ctx := context.Background()
+
+	t.Run("multiple results with bindings", func(t *testing.T) {
+		rs := gt.R1(client.QueryResultSet(ctx, "x := data.items.list[i]", nil)).NoError(t)
+		gt.A(t, rs).Length(3)
+		for i, r := range rs {
+			gt.Equal(t, r.Bindings["i"], any(float64(i)))
+			gt.Equal(t, r.Bindings["x"], any([]string{"blue", "white", "red"}[i]))
+			gt.A(t, r.Expressions).Length(1)
+			gt.Equal(t, r.Expressions[0].Text, "x := data.items.list[i]")
+		}
+	})
+
+	t.Run("multiple expressions", func(t *testing.T) {
+		rs := gt.R1(client.QueryResultSet(ctx, "x := data.items.limit; input.n < x", map[string]any{"n": 1})).NoError(t)
+		gt.A(t, rs).Length(1)
+		gt.A(t, rs[0].Expressions).Length(2)
+		gt.Equal(t, rs[0].Expressions[1].Value, any(true))
+		gt.Equal(t, rs[0].Bindings["x"], any(float64(2)))
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		rs := gt.R1(client.QueryResultSet(ctx, "data.items.unknown", nil)).NoError(t)
+		gt.A(t, rs).Length(0)
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := client.QueryResultSet(ctx, "x := ", nil)
+		gt.Error(t, err)
+	})
+}
+
+func TestRemoteQueryResultSet(t *testing.T) {
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			gt.Equal(t, req.URL.String(), "https://example.com/v1/query")
+
+			var body struct {
+				Query string         `json:"query"`
+				Input map[string]any `json:"input"`
+			}
+			gt.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			gt.Equal(t, body.Query, "x := data.items.list[i]")
+			gt.Equal(t, body.Input, map[string]any{"user": "alice"})
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"result": [{"i": 0, "x": "blue"}, {"i": 1, "x": "white"}]}`)),
+			}, nil
+		},
+	}
+	client := gt.R1(opac.New(opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)))).NoError(t)
+
+	rs := gt.R1(client.QueryResultSet(context.Background(), "x := data.items.list[i]", map[string]any{"user": "alice"})).NoError(t)
+	gt.A(t, rs).Length(2)
+	gt.Equal(t, rs[1].Bindings, map[string]any{"i": float64(1), "x": "white"})
+	gt.A(t, rs[1].Expressions).Length(0)
+}
@@ -0,0 +1,274 @@
+package opac
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// SQLPredicate is a parameterised SQL predicate translated from residual queries of partial evaluation. Where can be used in a WHERE clause with Args as its parameters.
+type SQLPredicate struct {
+	Where string
+	Args  []any
+}
+
+// SQLOption is a function that configures translation into SQL.
+type SQLOption func(*sqlTranslator)
+
+// WithSQLPlaceholder sets the function to create a placeholder of the n-th parameter (starting from 1). The default placeholder is "?".
+//
+// Example:
+//
+//	// PostgreSQL style placeholders: $1, $2, ...
+//	opac.WithSQLPlaceholder(func(n int) string { return fmt.Sprintf("$%d", n) })
+func WithSQLPlaceholder(placeholder func(n int) string) SQLOption {
+	return func(t *sqlTranslator) {
+		t.placeholder = placeholder
+	}
+}
+
+// SQL translates the residual queries into a parameterised SQL predicate. The columns maps references of unknowns to column names, such as "input.resource.owner" to "documents.owner". Column names are written into the predicate as they are, so they must not come from untrusted input.
+//
+// Supported expressions are comparisons (==, =, !=, <, <=, >, >=) between a mapped reference and a scalar value or another mapped reference, `in` with an array or a set of scalar values, a mapped reference alone (compared with TRUE), and negation with `not`. Expressions of a query are joined with AND, and queries are joined with OR and enclosed in parentheses, so that the predicate can be combined with other conditions. A comparison with null is translated into IS NULL or IS NOT NULL. Note that a negated expression does not match rows with NULL column while Rego `not` is true for an undefined value.
+//
+// The predicate is "1 = 0" if there is no residual query (always false), and "1 = 1" if a residual query is empty (always true). *SQLTranslationError is returned if the residual queries have other constructs, such as other builtin functions, variables, `with` modifiers, unmapped references or support modules.
+//
+// Example:
+//
+//	result, err := client.Partial(ctx, "data.authz.allow == true", input, []string{"input.resource"})
+//	pred, err := result.SQL(map[string]string{"input.resource.owner": "owner"})
+//	rows, err := db.QueryContext(ctx, "SELECT * FROM documents WHERE "+pred.Where, pred.Args...)
+func (p *PartialResult) SQL(columns map[string]string, options ...SQLOption) (*SQLPredicate, error) {
+	t := &sqlTranslator{
+		columns:     columns,
+		placeholder: func(int) string { return "?" },
+	}
+	for _, opt := range options {
+		opt(t)
+	}
+
+	if len(p.Support) > 0 {
+		return nil, &SQLTranslationError{
+			Expr:   p.Support[0].Package.String(),
+			Reason: "support modules are not supported",
+		}
+	}
+	if len(p.Queries) == 0 {
+		return &SQLPredicate{Where: "1 = 0"}, nil
+	}
+
+	clauses := make([]string, 0, len(p.Queries))
+	for _, query := range p.Queries {
+		if len(query) == 0 {
+			return &SQLPredicate{Where: "1 = 1"}, nil
+		}
+
+		clause, err := t.query(query)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+
+	if len(clauses) == 1 {
+		return &SQLPredicate{Where: clauses[0], Args: t.args}, nil
+	}
+	// Enclose the whole disjunction so that the predicate can be combined with other conditions by AND
+	return &SQLPredicate{Where: "((" + strings.Join(clauses, ") OR (") + "))", Args: t.args}, nil
+}
+
+type sqlTranslator struct {
+	columns     map[string]string
+	placeholder func(n int) string
+	args        []any
+}
+
+// sqlOperators maps comparison operators of Rego to SQL.
+var sqlOperators = map[string]string{
+	ast.Equality.Name:      "=",
+	ast.Equal.Name:         "=",
+	ast.NotEqual.Name:      "<>",
+	ast.LessThan.Name:      "<",
+	ast.LessThanEq.Name:    "<=",
+	ast.GreaterThan.Name:   ">",
+	ast.GreaterThanEq.Name: ">=",
+}
+
+// flippedOperators is used to swap operands of a comparison.
+var flippedOperators = map[string]string{
+	"=":  "=",
+	"<>": "<>",
+	"<":  ">",
+	"<=": ">=",
+	">":  "<",
+	">=": "<=",
+}
+
+func (t *sqlTranslator) query(body ast.Body) (string, error) {
+	exprs := make([]string, 0, len(body))
+	for _, expr := range body {
+		s, err := t.expr(expr)
+		if err != nil {
+			return "", err
+		}
+		exprs = append(exprs, s)
+	}
+	return strings.Join(exprs, " AND "), nil
+}
+
+func (t *sqlTranslator) expr(expr *ast.Expr) (string, error) {
+	if len(expr.With) > 0 {
+		return "", t.unsupported(expr, "with modifier is not supported")
+	}
+
+	var s string
+	var err error
+	switch {
+	case expr.IsCall():
+		s, err = t.call(expr)
+	default:
+		term, ok := expr.Terms.(*ast.Term)
+		if !ok {
+			return "", t.unsupported(expr, "expression is not supported")
+		}
+		column, ok := t.column(term)
+		if !ok {
+			return "", t.unsupported(expr, "term must be a mapped reference")
+		}
+		s = column + " = " + t.arg(true)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if expr.Negated {
+		return "NOT (" + s + ")", nil
+	}
+	return s, nil
+}
+
+func (t *sqlTranslator) call(expr *ast.Expr) (string, error) {
+	name := expr.Operator().String()
+	operands := expr.Operands()
+
+	if name == ast.Member.Name {
+		return t.member(expr, operands[0], operands[1])
+	}
+
+	op, ok := sqlOperators[name]
+	if !ok {
+		return "", t.unsupported(expr, fmt.Sprintf("function %s is not supported", name))
+	}
+	if len(operands) != 2 {
+		return "", t.unsupported(expr, "comparison must have two operands")
+	}
+
+	left, right := operands[0], operands[1]
+	leftColumn, leftIsColumn := t.column(left)
+	rightColumn, rightIsColumn := t.column(right)
+
+	switch {
+	case leftIsColumn && rightIsColumn:
+		return leftColumn + " " + op + " " + rightColumn, nil
+	case rightIsColumn:
+		return t.compare(expr, rightColumn, flippedOperators[op], left)
+	case leftIsColumn:
+		return t.compare(expr, leftColumn, op, right)
+	default:
+		return "", t.unsupported(expr, "comparison must have a mapped reference")
+	}
+}
+
+// compare translates a comparison between the column and the scalar value.
+func (t *sqlTranslator) compare(expr *ast.Expr, column, op string, value *ast.Term) (string, error) {
+	if _, ok := value.Value.(ast.Null); ok {
+		switch op {
+		case "=":
+			return column + " IS NULL", nil
+		case "<>":
+			return column + " IS NOT NULL", nil
+		default:
+			return "", t.unsupported(expr, "null can be compared only by equality")
+		}
+	}
+
+	v, ok := scalarValue(value)
+	if !ok {
+		return "", t.unsupported(expr, "operand must be a scalar value")
+	}
+	return column + " " + op + " " + t.arg(v), nil
+}
+
+// member translates `x in collection` into IN.
+func (t *sqlTranslator) member(expr *ast.Expr, elem, collection *ast.Term) (string, error) {
+	column, ok := t.column(elem)
+	if !ok {
+		return "", t.unsupported(expr, "element of in must be a mapped reference")
+	}
+
+	var terms []*ast.Term
+	switch c := collection.Value.(type) {
+	case *ast.Array:
+		c.Foreach(func(term *ast.Term) { terms = append(terms, term) })
+	case ast.Set:
+		c.Sorted().Foreach(func(term *ast.Term) { terms = append(terms, term) })
+	default:
+		return "", t.unsupported(expr, "collection of in must be an array or a set")
+	}
+
+	if len(terms) == 0 {
+		return "1 = 0", nil
+	}
+
+	placeholders := make([]string, 0, len(terms))
+	for _, term := range terms {
+		v, ok := scalarValue(term)
+		if !ok {
+			return "", t.unsupported(expr, "collection of in must have only scalar values")
+		}
+		placeholders = append(placeholders, t.arg(v))
+	}
+	return column + " IN (" + strings.Join(placeholders, ", ") + ")", nil
+}
+
+// column returns the column name of the mapped reference.
+func (t *sqlTranslator) column(term *ast.Term) (string, bool) {
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return "", false
+	}
+	column, ok := t.columns[ref.String()]
+	return column, ok
+}
+
+// arg adds the value as a parameter and returns its placeholder.
+func (t *sqlTranslator) arg(v any) string {
+	t.args = append(t.args, v)
+	return t.placeholder(len(t.args))
+}
+
+func (t *sqlTranslator) unsupported(expr *ast.Expr, reason string) error {
+	return &SQLTranslationError{
+		Expr:   expr.String(),
+		Reason: reason,
+	}
+}
+
+// scalarValue converts a scalar term into a Go value for a SQL parameter.
+func scalarValue(term *ast.Term) (any, bool) {
+	switch v := term.Value.(type) {
+	case ast.String:
+		return string(v), true
+	case ast.Boolean:
+		return bool(v), true
+	case ast.Number:
+		if i, ok := v.Int64(); ok {
+			return i, true
+		}
+		if f, ok := v.Float64(); ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,164 @@
+package opac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+var sqlColumns = map[string]string{
+	"input.resource.owner":    "owner",
+	"input.resource.public":   "public",
+	"input.resource.archived": "archived",
+	"input.resource.level":    "level",
+	"input.resource.team":     "team",
+	"input.resource.reviewer": "reviewer",
+}
+
+func TestPartialSQL(t *testing.T) {
+	type testCase struct {
+		queries []string
+		where   string
+		args    []any
+		isErr   bool
+	}
+
+	doTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			result := &opac.PartialResult{}
+			for _, q := range tc.queries {
+				result.Queries = append(result.Queries, ast.MustParseBody(q))
+			}
+
+			pred, err := result.SQL(sqlColumns)
+			if tc.isErr {
+				var sqlErr *opac.SQLTranslationError
+				gt.True(t, errors.As(err, &sqlErr))
+				return
+			}
+			gt.NoError(t, err)
+			gt.Equal(t, pred.Where, tc.where)
+			gt.Equal(t, pred.Args, tc.args)
+		}
+	}
+
+	t.Run("equality", doTest(testCase{
+		queries: []string{`"bob" = input.resource.owner`},
+		where:   "owner = ?",
+		args:    []any{"bob"},
+	}))
+
+	t.Run("inequality", doTest(testCase{
+		queries: []string{`input.resource.owner != "bob"`},
+		where:   "owner <> ?",
+		args:    []any{"bob"},
+	}))
+
+	t.Run("flipped comparison", doTest(testCase{
+		queries: []string{`3 < input.resource.level`},
+		where:   "level > ?",
+		args:    []any{int64(3)},
+	}))
+
+	t.Run("columns", doTest(testCase{
+		queries: []string{`input.resource.owner == input.resource.reviewer`},
+		where:   "owner = reviewer",
+	}))
+
+	t.Run("null", doTest(testCase{
+		queries: []string{`input.resource.reviewer != null`},
+		where:   "reviewer IS NOT NULL",
+	}))
+
+	t.Run("in", doTest(testCase{
+		queries: []string{`input.resource.team in {"red", "blue"}`},
+		where:   "team IN (?, ?)",
+		args:    []any{"blue", "red"},
+	}))
+
+	t.Run("in empty array", doTest(testCase{
+		queries: []string{`input.resource.team in []`},
+		where:   "1 = 0",
+	}))
+
+	t.Run("and, or and not", doTest(testCase{
+		queries: []string{
+			`"bob" = input.resource.owner`,
+			`input.resource.public; not input.resource.archived`,
+		},
+		where: "((owner = ?) OR (public = ? AND NOT (archived = ?)))",
+		args:  []any{"bob", true, true},
+	}))
+
+	t.Run("always true", doTest(testCase{
+		queries: []string{`"bob" = input.resource.owner`, ``},
+		where:   "1 = 1",
+	}))
+
+	t.Run("always false", doTest(testCase{
+		where: "1 = 0",
+	}))
+
+	t.Run("unmapped reference", doTest(testCase{
+		queries: []string{`input.resource.name = "x"`},
+		isErr:   true,
+	}))
+
+	t.Run("unsupported function", doTest(testCase{
+		queries: []string{`startswith(input.resource.owner, "b")`},
+		isErr:   true,
+	}))
+
+	t.Run("variable", doTest(testCase{
+		queries: []string{`x = input.resource.owner; x = "bob"`},
+		isErr:   true,
+	}))
+
+	t.Run("with modifier", doTest(testCase{
+		queries: []string{`input.resource.public with input.resource.public as true`},
+		isErr:   true,
+	}))
+
+	t.Run("support modules", func(t *testing.T) {
+		result := &opac.PartialResult{
+			Queries: []ast.Body{ast.MustParseBody(`data.partial.authz.allow`)},
+			Support: []*ast.Module{ast.MustParseModule("package partial.authz\n\nallow if input.resource.public\n")},
+		}
+		_, err := result.SQL(sqlColumns)
+		var sqlErr *opac.SQLTranslationError
+		gt.True(t, errors.As(err, &sqlErr))
+	})
+}
+
+func TestPartialSQLPlaceholder(t *testing.T) {
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": partialPolicy}))).NoError(t)
+	ctx := context.Background()
+
+	input := map[string]any{"subject": map[string]any{"name": "bob", "role": "user"}}
+	result := gt.R1(client.Partial(ctx, "data.authz.allow == true", input, []string{"input.resource"})).NoError(t)
+
+	pred := gt.R1(result.SQL(sqlColumns, opac.WithSQLPlaceholder(func(n int) string {
+		return fmt.Sprintf("$%d", n)
+	}))).NoError(t)
+	gt.Equal(t, pred.Where, "((owner = $1) OR (public = $2 AND NOT (archived = $3)))")
+	gt.Equal(t, pred.Args, []any{"bob", true, true})
+}
+
+func TestPartialSQLCombined(t *testing.T) {
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": partialPolicy}))).NoError(t)
+	ctx := context.Background()
+
+	input := map[string]any{"subject": map[string]any{"name": "bob", "role": "user"}}
+	result := gt.R1(client.Partial(ctx, "data.authz.allow == true", input, []string{"input.resource"})).NoError(t)
+	pred := gt.R1(result.SQL(sqlColumns)).NoError(t)
+
+	// The tenant condition must apply to every query of the disjunction
+	where := "tenant_id = ? AND " + pred.Where
+	gt.Equal(t, where, "tenant_id = ? AND ((owner = ?) OR (public = ? AND NOT (archived = ?)))")
+	gt.Equal(t, append([]any{"tenant-a"}, pred.Args...), []any{"tenant-a", "bob", true, true})
+}
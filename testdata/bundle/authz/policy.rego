@@ -0,0 +1,5 @@
+package authz
+
+allow if {
+    data.roles[input.user] == "admin"
+}
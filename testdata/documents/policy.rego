@@ -0,0 +1,9 @@
+package authz
+
+allow if {
+    data.roles[input.user] == "admin"
+}
+
+allow if {
+    input.ip in data.allowlist.ips
+}
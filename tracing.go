@@ -0,0 +1,71 @@
+package opac
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/m-mizutani/opac"
+
+// WithTracerProvider enables OpenTelemetry tracing with the tracer provider. A span is created for every query with attributes of the query, source type, revision, result presence and error. Local sources also create spans for compiling and reloading policies. Tracing is disabled by default.
+//
+// Example:
+//
+//	client, err := opac.New(opac.Files("policy"),
+//		opac.WithTracerProvider(otel.GetTracerProvider()),
+//	)
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(cfg *config) {
+		cfg.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// WithPropagator sets the propagator to inject the trace context into HTTP headers of requests to OPA server by Remote source. The default is the global propagator of otel.GetTextMapPropagator.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(cfg *config) {
+		cfg.propagator = propagator
+	}
+}
+
+func defaultTracer() trace.Tracer {
+	return noop.NewTracerProvider().Tracer(tracerName)
+}
+
+func defaultPropagator() propagation.TextMapPropagator {
+	return otel.GetTextMapPropagator()
+}
+
+// startQuerySpan starts a span of a query.
+func (c *Client) startQuerySpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return c.cfg.tracer.Start(ctx, name,
+		trace.WithAttributes(
+			attribute.String("opac.query", query),
+			attribute.String("opac.source", sourceType(c.src)),
+		),
+	)
+}
+
+// endQuerySpan records the result of a query and ends the span.
+func (c *Client) endQuerySpan(span trace.Span, defined bool, path DecisionPath, err error) {
+	span.SetAttributes(
+		attribute.String("opac.revision", c.src.Revision()),
+		attribute.Bool("opac.result.defined", defined),
+		attribute.String("opac.decision_path", string(path)),
+	)
+	endSpan(span, err)
+}
+
+// endSpan records the error if any and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,135 @@
+package opac_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newSpanRecorder() (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	recorder := tracetest.NewSpanRecorder()
+	return recorder, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+}
+
+func findSpan(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("span %s is not found", name)
+	return nil
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracingQuery(t *testing.T) {
+	recorder, provider := newSpanRecorder()
+	client := gt.R1(opac.New(
+		opac.Data(map[string]string{"policy.rego": decisionPolicy}),
+		opac.WithTracerProvider(provider),
+	)).NoError(t)
+
+	compile := findSpan(t, recorder.Ended(), "opac.Compile")
+	gt.Equal(t, compile.Status().Code, codes.Unset)
+
+	ctx := context.Background()
+	var allow bool
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", map[string]any{"user": "alice"}, &allow))
+	gt.Error(t, client.Query(ctx, "data.authz.unknown", nil, &allow))
+	gt.R1(client.QueryResultSet(ctx, "x := data.authz.allow", map[string]any{"user": "bob"})).NoError(t)
+
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() != "opac.Compile" {
+			spans = append(spans, span)
+		}
+	}
+	gt.A(t, spans).Length(3)
+
+	success := spanAttributes(spans[0])
+	gt.Equal(t, spans[0].Name(), "opac.Query")
+	gt.Equal(t, success["opac.query"].AsString(), "data.authz.allow")
+	gt.Equal(t, success["opac.source"].AsString(), "data")
+	gt.True(t, success["opac.result.defined"].AsBool())
+	gt.Equal(t, success["opac.decision_path"].AsString(), "evaluated")
+	gt.Equal(t, spans[0].Status().Code, codes.Unset)
+
+	failure := spanAttributes(spans[1])
+	gt.False(t, failure["opac.result.defined"].AsBool())
+	gt.Equal(t, spans[1].Status().Code, codes.Error)
+	gt.A(t, spans[1].Events()).Length(1)
+
+	gt.Equal(t, spans[2].Name(), "opac.QueryResultSet")
+	gt.True(t, spanAttributes(spans[2])["opac.result.defined"].AsBool())
+}
+
+func TestTracingRemotePropagation(t *testing.T) {
+	recorder, provider := newSpanRecorder()
+
+	var traceparent string
+	mock := &httpMock{
+		do: func(req *http.Request) (*http.Response, error) {
+			traceparent = req.Header.Get("traceparent")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"result": true}`)),
+			}, nil
+		},
+	}
+	client := gt.R1(opac.New(
+		opac.Remote("https://example.com/v1", opac.WithHTTPClient(mock)),
+		opac.WithTracerProvider(provider),
+		opac.WithPropagator(propagation.TraceContext{}),
+	)).NoError(t)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	var allow bool
+	gt.NoError(t, client.Query(ctx, "data.authz.allow", nil, &allow))
+	parent.End()
+
+	query := findSpan(t, recorder.Ended(), "opac.Query")
+	gt.Equal(t, query.Parent().SpanID(), parent.SpanContext().SpanID())
+	gt.Equal(t, spanAttributes(query)["opac.source"].AsString(), "remote")
+	gt.True(t, strings.Contains(traceparent, query.SpanContext().TraceID().String()))
+	gt.True(t, strings.Contains(traceparent, query.SpanContext().SpanID().String()))
+}
+
+func TestTracingReload(t *testing.T) {
+	recorder, provider := newSpanRecorder()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "color.rego"), "package color\nnumber := 5")
+
+	events := make(chan opac.ReloadEvent, 16)
+	client := gt.R1(opac.New(opac.Files(dir),
+		opac.WithTracerProvider(provider),
+		opac.WithWatch(10*time.Millisecond),
+		opac.WithReloadCallback(func(event opac.ReloadEvent) { events <- event }),
+	)).NoError(t)
+	defer client.Close()
+
+	writeFile(t, filepath.Join(dir, "color.rego"), "package color\nnumber := ")
+	gt.Error(t, waitReload(t, events).Err)
+
+	reload := findSpan(t, recorder.Ended(), "opac.Reload")
+	gt.Equal(t, reload.Status().Code, codes.Error)
+}
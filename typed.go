@@ -0,0 +1,54 @@
+package opac
+
+import "context"
+
+// QueryAs evaluates the query and returns the result decoded into T. It works in the same manner as Client.Query, but the type of the result is checked at compile time.
+//
+// Example:
+//
+//	type Result struct {
+//		Allow bool `json:"allow"`
+//	}
+//
+//	result, err := opac.QueryAs[Result](ctx, client, "data.authz", input)
+func QueryAs[T any](ctx context.Context, client *Client, query string, input any, options ...QueryOption) (T, error) {
+	var output T
+	if err := client.Query(ctx, query, input, &output, options...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return output, nil
+}
+
+// Decision is a typed handle bound to a fixed query. It can be declared once at package level and evaluated with any client. A Decision is safe for concurrent use by multiple goroutines.
+type Decision[T any] struct {
+	query   string
+	options []QueryOption
+}
+
+// NewDecision creates a Decision for the query. The options are applied to every evaluation before options given to Eval.
+//
+// Example:
+//
+//	var allowDecision = opac.NewDecision[bool]("data.authz.allow")
+//
+//	allowed, err := allowDecision.Eval(ctx, client, input)
+func NewDecision[T any](query string, options ...QueryOption) *Decision[T] {
+	return &Decision[T]{
+		query:   query,
+		options: options,
+	}
+}
+
+// Query returns the query of the decision.
+func (d *Decision[T]) Query() string {
+	return d.query
+}
+
+// Eval evaluates the decision with the client and input, and returns the decoded result.
+func (d *Decision[T]) Eval(ctx context.Context, client *Client, input any, options ...QueryOption) (T, error) {
+	opts := make([]QueryOption, 0, len(d.options)+len(options))
+	opts = append(opts, d.options...)
+	opts = append(opts, options...)
+	return QueryAs[T](ctx, client, d.query, input, opts...)
+}
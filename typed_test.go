@@ -0,0 +1,68 @@
+package opac_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+const typedPolicy = `package authz
+
+allow := input.user == "alice"
+reason := "admin" if { input.user == "alice" }
+`
+
+type authzResult struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+func TestQueryAs(t *testing.T) {
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": typedPolicy}))).NoError(t)
+	ctx := context.Background()
+
+	t.Run("struct", func(t *testing.T) {
+		result := gt.R1(opac.QueryAs[authzResult](ctx, client, "data.authz", map[string]any{"user": "alice"})).NoError(t)
+		gt.Equal(t, result, authzResult{Allow: true, Reason: "admin"})
+	})
+
+	t.Run("scalar", func(t *testing.T) {
+		allowed := gt.R1(opac.QueryAs[bool](ctx, client, "data.authz.allow", map[string]any{"user": "bob"})).NoError(t)
+		gt.False(t, allowed)
+	})
+
+	t.Run("no result", func(t *testing.T) {
+		result, err := opac.QueryAs[authzResult](ctx, client, "data.authz.reason", map[string]any{"user": "bob"})
+		gt.True(t, errors.Is(err, opac.ErrNoEvalResult))
+		gt.Equal(t, result, authzResult{})
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		_, err := opac.QueryAs[int](ctx, client, "data.authz.allow", map[string]any{"user": "alice"})
+		gt.Error(t, err)
+	})
+}
+
+var allowDecision = opac.NewDecision[bool]("data.authz.allow")
+
+func TestDecision(t *testing.T) {
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": typedPolicy}))).NoError(t)
+	ctx := context.Background()
+
+	gt.Equal(t, allowDecision.Query(), "data.authz.allow")
+	gt.True(t, gt.R1(allowDecision.Eval(ctx, client, map[string]any{"user": "alice"})).NoError(t))
+	gt.False(t, gt.R1(allowDecision.Eval(ctx, client, map[string]any{"user": "bob"})).NoError(t))
+
+	t.Run("with options", func(t *testing.T) {
+		decision := opac.NewDecision[authzResult]("data.authz.unknown",
+			opac.WithQueryFailurePolicy(opac.DefaultOutput(map[string]any{"allow": false, "reason": "default"})),
+		)
+		var path opac.DecisionPath
+		result := gt.R1(decision.Eval(ctx, client, map[string]any{"user": "alice"}, opac.WithDecisionPath(&path))).NoError(t)
+		gt.Equal(t, result, authzResult{Reason: "default"})
+		gt.Equal(t, path, opac.PathDefault)
+	})
+}
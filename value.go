@@ -0,0 +1,158 @@
+package opac
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// decodeResult converts the result value into the output in the same manner as JSON encoding. Outputs of *any, *map[string]any, *[]any, *bool, *string and *float64 are set directly from the value without JSON encoding, and other outputs such as structs fall back to JSON encoding and decoding. An output of *ast.Value is converted from the Go value of the result, because rego returns results only as Go values, so it is not faster than decoding into a map.
+func decodeResult(value, output any) error {
+	if ok, err := decodeDirect(value, output); ok {
+		return err
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+	if err := json.Unmarshal(raw, output); err != nil {
+		return fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+	return nil
+}
+
+// decodeDirect sets the value to the output without JSON encoding. It returns false if the output type or the value is not supported, and then the caller should fall back to JSON encoding.
+func decodeDirect(value, output any) (bool, error) {
+	if out, ok := output.(*ast.Value); ok {
+		v, err := ast.InterfaceToValue(value)
+		if err != nil {
+			return true, fmt.Errorf("failed to convert result to ast.Value: %w", err)
+		}
+		*out = v
+		return true, nil
+	}
+
+	normalized, ok := normalizeValue(value)
+	if !ok {
+		return false, nil
+	}
+
+	switch out := output.(type) {
+	case *any:
+		*out = normalized
+		return true, nil
+
+	case *map[string]any:
+		switch v := normalized.(type) {
+		case nil:
+			*out = nil
+		case map[string]any:
+			// Keep keys of the existing map as json.Unmarshal does
+			if *out == nil {
+				*out = v
+			} else {
+				for key, value := range v {
+					(*out)[key] = value
+				}
+			}
+		default:
+			return false, nil
+		}
+		return true, nil
+
+	case *[]any:
+		switch v := normalized.(type) {
+		case nil:
+			*out = nil
+		case []any:
+			*out = v
+		default:
+			return false, nil
+		}
+		return true, nil
+
+	case *bool:
+		v, ok := normalized.(bool)
+		if ok {
+			*out = v
+		}
+		return ok, nil
+
+	case *string:
+		v, ok := normalized.(string)
+		if ok {
+			*out = v
+		}
+		return ok, nil
+
+	case *float64:
+		v, ok := normalized.(float64)
+		if ok {
+			*out = v
+		}
+		return ok, nil
+	}
+
+	return false, nil
+}
+
+// normalizeValue returns a copy of the value with the types produced by JSON decoding into `any`: json.Number is converted to float64 and containers are copied. It returns false if the value has a type that must be encoded to JSON, such as a struct.
+func normalizeValue(value any) (any, bool) {
+	switch v := value.(type) {
+	case nil, bool, string, float64:
+		return v, true
+
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, false
+		}
+		return f, true
+
+	case int:
+		return float64(v), true
+
+	case int64:
+		return float64(v), true
+
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, elem := range v {
+			n, ok := normalizeValue(elem)
+			if !ok {
+				return nil, false
+			}
+			m[key] = n
+		}
+		return m, true
+
+	case []any:
+		s := make([]any, len(v))
+		for i, elem := range v {
+			n, ok := normalizeValue(elem)
+			if !ok {
+				return nil, false
+			}
+			s[i] = n
+		}
+		return s, true
+	}
+
+	return nil, false
+}
+
+// inputValue returns the input as a value for JSON encoding. An ast.Value input is converted to Go values.
+func inputValue(input any) (any, error) {
+	v, ok := input.(ast.Value)
+	if !ok {
+		return input, nil
+	}
+
+	converted, err := ast.JSON(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert input from ast.Value: %w", err)
+	}
+	return converted, nil
+}
@@ -0,0 +1,221 @@
+package opac_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+const valuePolicy = `package value
+
+result := {
+	"name": input.metadata.name,
+	"count": count(input.spec.containers),
+	"ratio": 0.5,
+	"tags": ["a", "b"],
+	"allow": true,
+}
+`
+
+func TestDecodeOutput(t *testing.T) {
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": valuePolicy}))).NoError(t)
+	ctx := context.Background()
+	input := newPodInput(3)
+
+	t.Run("map", func(t *testing.T) {
+		var output map[string]any
+		gt.NoError(t, client.Query(ctx, "data.value.result", input, &output))
+		gt.Equal(t, output, map[string]any{
+			"name":  "pod",
+			"count": float64(3),
+			"ratio": 0.5,
+			"tags":  []any{"a", "b"},
+			"allow": true,
+		})
+	})
+
+	t.Run("map keeps existing keys", func(t *testing.T) {
+		output := map[string]any{"extra": "value"}
+		gt.NoError(t, client.Query(ctx, "data.value.result", input, &output))
+		gt.Equal(t, output["extra"], any("value"))
+		gt.Equal(t, output["count"], any(float64(3)))
+	})
+
+	t.Run("any", func(t *testing.T) {
+		var output any
+		gt.NoError(t, client.Query(ctx, "data.value.result.count", input, &output))
+		gt.Equal(t, output, any(float64(3)))
+	})
+
+	t.Run("scalar", func(t *testing.T) {
+		var allow bool
+		gt.NoError(t, client.Query(ctx, "data.value.result.allow", input, &allow))
+		gt.True(t, allow)
+
+		var name string
+		gt.NoError(t, client.Query(ctx, "data.value.result.name", input, &name))
+		gt.Equal(t, name, "pod")
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		var output map[string]any
+		gt.Error(t, client.Query(ctx, "data.value.result.name", input, &output))
+	})
+
+	t.Run("ast.Value", func(t *testing.T) {
+		var output ast.Value
+		gt.NoError(t, client.Query(ctx, "data.value.result", input, &output))
+		gt.Equal(t, output.Compare(ast.MustParseTerm(`{"name": "pod", "count": 3, "ratio": 0.5, "tags": ["a", "b"], "allow": true}`).Value), 0)
+	})
+}
+
+func TestParsedInput(t *testing.T) {
+	input := gt.R1(ast.InterfaceToValue(newPodInput(2))).NoError(t)
+
+	t.Run("local", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": valuePolicy}))).NoError(t)
+		var count int
+		gt.NoError(t, client.Query(context.Background(), "data.value.result.count", input, &count))
+		gt.Equal(t, count, 2)
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		client := gt.R1(opac.New(opac.Remote("https://example.com/v1", opac.WithHTTPClient(&httpMock{
+			do: func(req *http.Request) (*http.Response, error) {
+				var body struct {
+					Input map[string]any `json:"input"`
+				}
+				gt.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				gt.Equal(t, body.Input["metadata"], any(map[string]any{"name": "pod"}))
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(`{"result": 2}`)),
+				}, nil
+			},
+		})))).NoError(t)
+
+		var count int
+		gt.NoError(t, client.Query(context.Background(), "data.value.result.count", input, &count))
+		gt.Equal(t, count, 2)
+	})
+}
+
+func newPodInput(containers int) map[string]any {
+	list := make([]any, containers)
+	for i := range list {
+		list[i] = map[string]any{
+			"name":  fmt.Sprintf("container-%d", i),
+			"image": "example.com/app:latest",
+			"env": []any{
+				map[string]any{"name": "MODE", "value": "production"},
+			},
+			"resources": map[string]any{
+				"limits": map[string]any{"cpu": "500m", "memory": "128Mi"},
+			},
+		}
+	}
+
+	return map[string]any{
+		"metadata": map[string]any{"name": "pod"},
+		"spec":     map[string]any{"containers": list},
+	}
+}
+
+// BenchmarkQueryDecode compares decoding the result with JSON encoding into a struct and a map, directly into a map, and converting into ast.Value.
+func BenchmarkQueryDecode(b *testing.B) {
+	policy := `package value
+
+result := input
+`
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}))).NoError(b)
+	ctx := context.Background()
+	// The input is parsed in advance to measure decoding of the result
+	input := gt.R1(ast.InterfaceToValue(newPodInput(100))).NoError(b)
+
+	type container struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	}
+	type pod struct {
+		Spec struct {
+			Containers []container `json:"containers"`
+		} `json:"spec"`
+	}
+
+	b.Run("struct (JSON round trip)", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var output pod
+			if err := client.Query(ctx, "data.value.result", input, &output); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("map (JSON round trip)", func(b *testing.B) {
+		// A named map type is not set directly and falls back to JSON encoding
+		type jsonMap map[string]any
+		for i := 0; i < b.N; i++ {
+			var output jsonMap
+			if err := client.Query(ctx, "data.value.result", input, &output); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var output map[string]any
+			if err := client.Query(ctx, "data.value.result", input, &output); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("ast.Value", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var output ast.Value
+			if err := client.Query(ctx, "data.value.result", input, &output); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkQueryInput compares passing the input as Go values and as a pre-built ast.Value.
+func BenchmarkQueryInput(b *testing.B) {
+	policy := `package value
+
+size := count(input.spec.containers)
+`
+	client := gt.R1(opac.New(opac.Data(map[string]string{"policy.rego": policy}))).NoError(b)
+	ctx := context.Background()
+	input := newPodInput(100)
+	parsed := gt.R1(ast.InterfaceToValue(input)).NoError(b)
+
+	b.Run("Go value", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var output int
+			if err := client.Query(ctx, "data.value.size", input, &output); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("ast.Value", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var output int
+			if err := client.Query(ctx, "data.value.size", parsed, &output); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
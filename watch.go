@@ -0,0 +1,139 @@
+package opac
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WithWatch enables watching policy files of Files source and Bundle source with a tarball or a directory path. The files are checked at the interval and policies are recompiled in background when a file is added, changed or removed. The new policies are used only if compilation succeeds, and the previous policies are kept on failure. The result of reloading is reported through the logger and the callback set by WithReloadCallback. Client.Close should be called to stop watching.
+func WithWatch(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.watchInterval = interval
+	}
+}
+
+// WithReloadCallback sets a callback that is called after policies are reloaded in background.
+func WithReloadCallback(callback func(event ReloadEvent)) Option {
+	return func(cfg *config) {
+		cfg.reloadCallback = callback
+	}
+}
+
+// ReloadEvent is a result of reloading policies in background.
+type ReloadEvent struct {
+	// Revision is the revision of policies served after reloading. It is the previous revision if reloading failed.
+	Revision string
+
+	// Err is an error of reloading. It is nil if reloading succeeded.
+	Err error
+}
+
+// fileStamp is a set of attributes to detect changes of a file.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+type fileStamps map[string]fileStamp
+
+// statFiles returns stamps of files matched with the filter under the paths.
+func statFiles(paths []string, filter func(name string) bool) (fileStamps, error) {
+	stamps := fileStamps{}
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !filter(filepath.ToSlash(path)) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			stamps[path] = fileStamp{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stamps, nil
+}
+
+// watcher runs a function periodically in background until it is stopped.
+type watcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// startPolling calls fn at the interval. The context given to fn is canceled when the watcher is stopped.
+func startPolling(interval time.Duration, fn func(ctx context.Context)) *watcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watcher{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}()
+
+	return w
+}
+
+// startWatcher polls file stamps and calls onChange when they are changed.
+func startWatcher(cfg *config, interval time.Duration, stat func() (fileStamps, error), onChange func()) *watcher {
+	last, err := stat()
+	if err != nil {
+		cfg.logger.Warn("Failed to check policy files", "error", err)
+	}
+
+	return startPolling(interval, func(ctx context.Context) {
+		// A failure of stat is also a change, and it is reported as a failure of reloading only once until the files are changed again.
+		current, err := stat()
+		if err != nil {
+			cfg.logger.Debug("Failed to check policy files", "error", err)
+			current = nil
+		}
+		if maps.Equal(last, current) && (last == nil) == (current == nil) {
+			return
+		}
+
+		last = current
+		cfg.logger.Debug("Policy files are changed", "file count", len(current))
+		onChange()
+	})
+}
+
+// stop stops polling and waits for the running function. It is safe to call for nil watcher and more than once.
+func (w *watcher) stop() {
+	if w == nil {
+		return
+	}
+
+	w.cancel()
+	w.wg.Wait()
+}
@@ -0,0 +1,113 @@
+package opac_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/m-mizutani/opac"
+)
+
+func waitReload(t *testing.T, ch chan opac.ReloadEvent) opac.ReloadEvent {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout to wait reload")
+		return opac.ReloadEvent{}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	gt.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	gt.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "color.rego"), "package color\nnumber := 5")
+
+	events := make(chan opac.ReloadEvent, 16)
+	client := gt.R1(opac.New(opac.Files(dir),
+		opac.WithWatch(10*time.Millisecond),
+		opac.WithReloadCallback(func(event opac.ReloadEvent) { events <- event }),
+	)).NoError(t)
+	defer client.Close()
+
+	query := func(q string) (out any) {
+		gt.NoError(t, client.Query(context.Background(), q, nil, &out))
+		return out
+	}
+	gt.Equal(t, query("data.color.number"), any(float64(5)))
+
+	t.Run("changed file", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "color.rego"), "package color\nnumber := 10")
+		gt.NoError(t, waitReload(t, events).Err)
+		gt.Equal(t, query("data.color.number"), any(float64(10)))
+	})
+
+	t.Run("added files", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "shape", "names", "data.json"), `["circle"]`)
+		gt.NoError(t, waitReload(t, events).Err)
+		writeFile(t, filepath.Join(dir, "shape", "shape.rego"), "package shape\nname := data.shape.names[0]")
+		gt.NoError(t, waitReload(t, events).Err)
+		gt.Equal(t, query("data.shape.name"), any("circle"))
+	})
+
+	t.Run("compile error keeps current policies", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "color.rego"), "package color\nnumber := ")
+		gt.Error(t, waitReload(t, events).Err)
+		gt.Equal(t, query("data.color.number"), any(float64(10)))
+	})
+
+	t.Run("removed file", func(t *testing.T) {
+		gt.NoError(t, os.Remove(filepath.Join(dir, "color.rego")))
+		gt.NoError(t, waitReload(t, events).Err)
+
+		var out any
+		gt.Equal(t, client.Query(context.Background(), "data.color.number", nil, &out), opac.ErrNoEvalResult)
+	})
+
+	t.Run("stop watching", func(t *testing.T) {
+		gt.NoError(t, client.Close())
+		writeFile(t, filepath.Join(dir, "color.rego"), "package color\nnumber := 20")
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected reload after close: %+v", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestWatchBundleDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range newTestBundle("v1") {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+
+	events := make(chan opac.ReloadEvent, 16)
+	client := gt.R1(opac.New(opac.Bundle(dir),
+		opac.WithWatch(10*time.Millisecond),
+		opac.WithReloadCallback(func(event opac.ReloadEvent) { events <- event }),
+	)).NoError(t)
+	defer client.Close()
+	gt.Equal(t, client.Revision(), "v1")
+
+	writeFile(t, filepath.Join(dir, ".manifest"), `{"revision": "v2", "roots": ["authz", "roles"]}`)
+	event := waitReload(t, events)
+	gt.NoError(t, event.Err)
+	gt.Equal(t, event.Revision, "v2")
+	gt.Equal(t, client.Revision(), "v2")
+
+	// module out of roots is rejected and the previous revision is kept
+	writeFile(t, filepath.Join(dir, ".manifest"), `{"revision": "v3", "roots": ["roles"]}`)
+	event = waitReload(t, events)
+	gt.Error(t, event.Err)
+	gt.Equal(t, event.Revision, "v2")
+	gt.Equal(t, client.Revision(), "v2")
+}